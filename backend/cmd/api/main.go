@@ -7,19 +7,32 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"syscall"
 	"time"
 
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
 	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
 	"github.com/samridh-111/balkan_task/internal/core/auth"
 	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/core/integrity"
+	"github.com/samridh-111/balkan_task/internal/core/mfa"
+	"github.com/samridh-111/balkan_task/internal/core/oidc"
+	"github.com/samridh-111/balkan_task/internal/core/orgs"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/core/retention"
+	"github.com/samridh-111/balkan_task/internal/core/settings"
+	"github.com/samridh-111/balkan_task/internal/core/signedurl"
+	"github.com/samridh-111/balkan_task/internal/core/stats"
 	"github.com/samridh-111/balkan_task/internal/core/users"
 	"github.com/samridh-111/balkan_task/internal/db/postgres"
 	"github.com/samridh-111/balkan_task/internal/http/handlers"
 	"github.com/samridh-111/balkan_task/internal/http/middleware"
 	"github.com/samridh-111/balkan_task/internal/pkg/logger"
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"github.com/samridh-111/balkan_task/internal/pkg/mailer"
 )
 
 func main() {
@@ -30,6 +43,9 @@ func main() {
 	}
 
 	log := logger.New()
+	for _, warning := range cfg.Warnings {
+		log.Warn("%s", warning)
+	}
 
 	db, err := postgres.NewDB(cfg, log)
 	if err != nil {
@@ -44,16 +60,69 @@ func main() {
 	}
 
 	userRepo := users.NewRepository(db)
-	fileRepo := files.NewRepository(db)
+	fileRepo := files.NewRepository(db, cfg.Logs.IPHashKey)
+	tokenRepo := auth.NewTokenRepository(db)
+	mfaRepo := mfa.NewRepository(db)
+	settingsRepo := settings.NewRepository(db)
+	attemptRepo := auth.NewLoginAttemptRepository(db)
+	orgRepo := orgs.NewRepository(db)
+	auditRepo := audit.NewRepository(db)
+
+	// Link log rows written before the hash chains existed, then keep
+	// checkpointing the chain heads.
+	integrityService := integrity.NewService(integrity.NewRepository(db), auditRepo, fileRepo, log)
+	if err := integrityService.LinkExisting(); err != nil {
+		log.Error("Failed to link log hash chains: %v", err)
+		os.Exit(1)
+	}
+	integrityService.Start(time.Duration(cfg.Logs.CheckpointInterval) * time.Minute)
+
+	// Anonymize client IPs and prune old downloads per the privacy policy.
+	retentionService := retention.NewService(fileRepo, &cfg.Logs, log)
+	retentionService.Start()
+
+	// HS256 signs with JWT_SECRET; RS256 and EdDSA use rotated key pairs.
+	var signingKeys *auth.KeyStore
+	if cfg.JWT.Algorithm != auth.AlgHS256 {
+		signingKeys, err = auth.NewKeyStore(auth.NewSigningKeyRepository(db), &cfg.JWT, log)
+		if err != nil {
+			log.Error("Failed to load JWT signing keys: %v", err)
+			os.Exit(1)
+		}
+		signingKeys.Start()
+	}
+
+	jwtService := auth.NewService(cfg, signingKeys)
+	mfaService := auth.NewMFAService(mfaRepo, settingsRepo, &cfg.MFA)
+	authService := auth.NewAuthService(userRepo, tokenRepo, jwtService, mfaService, auth.NewLoginThrottle(attemptRepo), &cfg.Auth)
+	urlSigner := signedurl.NewSigner(cfg)
+
+	mail, err := mailer.New(&cfg.Mail, log)
+	if err != nil {
+		log.Error("Failed to configure mailer: %v", err)
+		os.Exit(1)
+	}
+	accountService := auth.NewAccountService(authService, mail, cfg.Auth.AppURL, log)
 
-	jwtService := auth.NewService(cfg)
-	authService := auth.NewAuthService(userRepo, jwtService)
+	authHandler := handlers.NewAuthHandler(authService, mfaService, accountService, auditRepo)
+	fileHandler := handlers.NewFileHandler(fileRepo, userRepo, orgRepo, auditRepo, urlSigner, cfg.Storage.Path)
+	orgHandler := handlers.NewOrgHandler(orgRepo, userRepo, auditRepo)
+	statsService := stats.NewService(stats.NewRepository(db), log)
+	statsService.StartSnapshots()
+	adminHandler := handlers.NewAdminHandler(authService, accountService, settingsRepo, attemptRepo, orgRepo, statsService, fileRepo, userRepo, auditRepo, integrityService, retentionService)
 
-	authHandler := handlers.NewAuthHandler(authService)
-	fileHandler := handlers.NewFileHandler(fileRepo, userRepo, cfg.Storage.Path)
-	adminHandler := handlers.NewAdminHandler()
+	// OIDC sign-in is optional and only routed when an issuer is configured.
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.OIDC.Issuer != "" {
+		oidcService := auth.NewOIDCService(oidc.NewProvider(&cfg.OIDC), authService)
+		oidcHandler = handlers.NewOIDCHandler(oidcService, auditRepo, cfg.OIDC.SuccessRedirect)
+	}
 
-	router := setupRouter(authHandler, fileHandler, adminHandler, jwtService)
+	router, err := setupRouter(authHandler, oidcHandler, fileHandler, orgHandler, adminHandler, authService, auditRepo, urlSigner, cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error("Failed to set up router: %v", err)
+		os.Exit(1)
+	}
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
@@ -84,24 +153,46 @@ func main() {
 	log.Info("Server exited")
 }
 
-func setupRouter(authHandler *handlers.AuthHandler, fileHandler *handlers.FileHandler, adminHandler *handlers.AdminHandler, jwtService *auth.Service) *gin.Engine {
+func setupRouter(authHandler *handlers.AuthHandler, oidcHandler *handlers.OIDCHandler, fileHandler *handlers.FileHandler, orgHandler *handlers.OrgHandler, adminHandler *handlers.AdminHandler, authService *auth.AuthService, auditRepo *audit.Repository, urlSigner *signedurl.Signer, trustedProxies []string) (*gin.Engine, error) {
 	router := gin.Default()
 
+	// Client IPs feed login throttling, audit records and IP-bound signed
+	// URLs, so forwarding headers are only believed from known proxies.
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
 	// CORS middleware
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:5174"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           12 * 60 * 60, // 12 hours
 	}))
 
+	router.Use(middleware.RequestID())
 	router.Use(middleware.ErrorHandler())
 	router.Use(middleware.RateLimitMiddleware())
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+	requireAuth := middleware.AuthMiddleware(authService, auditRepo)
+	// Impersonating admins may not change how the account is secured.
+	noImpersonation := middleware.DenyImpersonation()
+
+	// Per-route permissions; for API keys these are also the required scopes.
+	filesRead := middleware.RequirePermission(rbac.PermFilesRead)
+	filesWrite := middleware.RequirePermission(rbac.PermFilesWrite)
+	sharesRead := middleware.RequirePermission(rbac.PermSharesRead)
+	sharesWrite := middleware.RequirePermission(rbac.PermSharesWrite)
+	orgsRead := middleware.RequirePermission(rbac.PermOrgsRead)
+	orgsWrite := middleware.RequirePermission(rbac.PermOrgsWrite)
+	adminWrite := middleware.RequirePermission(rbac.PermAdminWrite)
 
 	v1 := router.Group("/api/v1")
 	{
@@ -109,44 +200,183 @@ func setupRouter(authHandler *handlers.AuthHandler, fileHandler *handlers.FileHa
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", requireAuth, authHandler.Logout)
+
+			auth.GET("/sessions", requireAuth, authHandler.ListSessions)
+			auth.DELETE("/sessions", requireAuth, noImpersonation, authHandler.RevokeOtherSessions)
+			auth.DELETE("/sessions/:id", requireAuth, noImpersonation, authHandler.RevokeSession)
+
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/verify-email/send", requireAuth, noImpersonation, authHandler.SendVerificationEmail)
+			auth.POST("/password/forgot", authHandler.ForgotPassword)
+			auth.POST("/password/reset", authHandler.ResetPassword)
+			auth.POST("/password/change", requireAuth, noImpersonation, authHandler.ChangePassword)
+
+			auth.POST("/mfa/verify", authHandler.VerifyMFA)
+			auth.GET("/mfa", requireAuth, noImpersonation, authHandler.MFAStatus)
+			auth.POST("/mfa/disable", requireAuth, noImpersonation, authHandler.DisableMFA)
+			auth.POST("/mfa/recovery-codes", requireAuth, noImpersonation, authHandler.RegenerateRecoveryCodes)
+
+			// Users who must enroll before signing in reach these with
+			// their enrollment token.
+			enrollAuth := middleware.MFAEnrollmentAuth(authService)
+			auth.POST("/mfa/enroll", enrollAuth, authHandler.EnrollMFA)
+			auth.POST("/mfa/enable", enrollAuth, authHandler.EnableMFA)
+
+			if oidcHandler != nil {
+				auth.GET("/oidc/login", oidcHandler.Login)
+				auth.GET("/oidc/callback", oidcHandler.Callback)
+			}
+		}
+
+		v1.GET("/audit", requireAuth, authHandler.ListAuditEvents)
+
+		apiKeys := v1.Group("/api-keys")
+		apiKeys.Use(requireAuth, noImpersonation)
+		{
+			apiKeys.POST("", authHandler.CreateAPIKey)
+			apiKeys.GET("", authHandler.ListAPIKeys)
+			apiKeys.DELETE("/:id", authHandler.RevokeAPIKey)
 		}
 
+		// Downloads also accept a signed URL in place of a Bearer token.
+		v1.GET("/files/:id/download", middleware.SignedURLOrAuth(urlSigner, authService, auditRepo), filesRead, fileHandler.Download)
+
 		files := v1.Group("/files")
-		files.Use(middleware.AuthMiddleware(jwtService))
+		files.Use(requireAuth)
+		{
+			files.POST("/check-duplicate", filesRead, fileHandler.CheckDuplicate)
+			files.POST("/upload", filesWrite, fileHandler.Upload)
+			files.GET("", filesRead, fileHandler.List)
+			files.GET("/:id", filesRead, fileHandler.Get)
+			files.DELETE("/:id", filesWrite, fileHandler.Delete)
+			files.POST("/:id/share", sharesWrite, fileHandler.Share)
+			files.POST("/:id/signed-url", sharesWrite, fileHandler.CreateSignedURL)
+			files.GET("/:id/analytics", sharesRead, fileHandler.FileAnalytics)
+			files.GET("/:id/downloads", sharesRead, fileHandler.FileDownloads)
+		}
+
+		shares := v1.Group("/shares")
+		shares.Use(requireAuth)
+		{
+			shares.POST("", sharesWrite, fileHandler.CreateShare)
+			shares.GET("", sharesRead, fileHandler.ListShares)
+			shares.GET("/:id/analytics", sharesRead, fileHandler.ShareAnalytics)
+			shares.GET("/:id/accesses", sharesRead, fileHandler.ShareAccesses)
+			shares.DELETE("/:id", sharesWrite, fileHandler.RevokeShare)
+		}
+
+		// Share links; non-public shares additionally require a signed-in user
+		shareLinks := v1.Group("/s")
+		shareLinks.Use(middleware.OptionalAuth(authService, auditRepo))
+		{
+			shareLinks.GET("/:token", fileHandler.ViewShare)
+			shareLinks.GET("/:token/download", fileHandler.DownloadShare)
+			shareLinks.GET("/:token/files/:file_id/download", fileHandler.DownloadShareItem)
+			shareLinks.GET("/:token/zip", fileHandler.DownloadShareZip)
+		}
+
+		folders := v1.Group("/folders")
+		folders.Use(requireAuth)
 		{
-			files.POST("/check-duplicate", fileHandler.CheckDuplicate)
-			files.POST("/upload", fileHandler.Upload)
-			files.GET("", fileHandler.List)
-			files.GET("/:id", fileHandler.Get)
-			files.GET("/:id/download", fileHandler.Download)
-			files.DELETE("/:id", fileHandler.Delete)
-			files.POST("/:id/share", fileHandler.Share)
+			folders.POST("", filesWrite, fileHandler.CreateFolder)
+			folders.GET("", filesRead, fileHandler.ListFolders)
+		}
+
+		// Roles within an organization are checked by the handlers
+		orgRoutes := v1.Group("/orgs")
+		orgRoutes.Use(requireAuth)
+		{
+			orgRoutes.POST("", orgsWrite, orgHandler.Create)
+			orgRoutes.GET("", orgsRead, orgHandler.List)
+			orgRoutes.GET("/:id", orgsRead, orgHandler.Get)
+			orgRoutes.PATCH("/:id", orgsWrite, orgHandler.Update)
+			orgRoutes.DELETE("/:id", orgsWrite, orgHandler.Delete)
+			orgRoutes.GET("/:id/members", orgsRead, orgHandler.ListMembers)
+			orgRoutes.POST("/:id/members", orgsWrite, orgHandler.AddMember)
+			orgRoutes.PATCH("/:id/members/:user_id", orgsWrite, orgHandler.UpdateMember)
+			orgRoutes.DELETE("/:id/members/:user_id", orgsWrite, orgHandler.RemoveMember)
+		}
+
+		fileRequests := v1.Group("/file-requests")
+		fileRequests.Use(requireAuth)
+		{
+			fileRequests.POST("", sharesWrite, fileHandler.CreateFileRequest)
+			fileRequests.GET("", sharesRead, fileHandler.ListFileRequests)
+			fileRequests.DELETE("/:id", sharesWrite, fileHandler.RevokeFileRequest)
+			fileRequests.GET("/:id/submissions", sharesRead, fileHandler.ListFileRequestSubmissions)
+		}
+
+		// Anonymous upload-only access through a file request token
+		public := v1.Group("/public")
+		{
+			public.GET("/file-requests/:token", fileHandler.GetPublicFileRequest)
+			public.POST("/file-requests/:token/upload", fileHandler.UploadToFileRequest)
 		}
 
 		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(jwtService))
+		admin.Use(requireAuth, middleware.RequirePermission(rbac.PermAdminRead))
 		{
 			admin.GET("/stats", adminHandler.GetStats)
+			admin.GET("/stats/orgs", adminHandler.GetOrgStats)
+			admin.GET("/stats/storage/series", adminHandler.GetStorageSeries)
+			admin.GET("/stats/storage/top", adminHandler.GetStorageTop)
+			admin.POST("/stats/storage/snapshots", adminWrite, adminHandler.TakeStorageSnapshot)
+			admin.PUT("/orgs/:id/quota", adminWrite, adminHandler.UpdateOrgQuota)
 			admin.GET("/files", adminHandler.GetAllFiles)
 			admin.GET("/users", adminHandler.GetAllUsers)
+			admin.GET("/users/:id/sessions", adminHandler.ListUserSessions)
+			admin.GET("/users/:id/audit", adminHandler.ListUserAuditEvents)
+			admin.POST("/users/:id/logout", adminWrite, adminHandler.LogoutUser)
+			admin.PUT("/users/:id/role", adminWrite, adminHandler.UpdateUserRole)
+			admin.PUT("/users/:id/quota", adminWrite, adminHandler.UpdateUserQuota)
+			admin.POST("/users/:id/suspend", adminWrite, adminHandler.SuspendUser)
+			admin.POST("/users/:id/unsuspend", adminWrite, adminHandler.UnsuspendUser)
+			admin.POST("/users/:id/reset-password", adminWrite, adminHandler.ResetUserPassword)
+			admin.DELETE("/users/:id", adminWrite, adminHandler.DeleteUser)
+			admin.POST("/users/:id/impersonate", adminWrite, adminHandler.ImpersonateUser)
+			admin.GET("/takedowns", adminHandler.ListTakedowns)
+			admin.POST("/takedowns", adminWrite, adminHandler.CreateTakedown)
+			admin.POST("/takedowns/:id/lift", adminWrite, adminHandler.LiftTakedown)
+			admin.GET("/holds", adminHandler.ListHolds)
+			admin.POST("/holds", adminWrite, adminHandler.CreateHold)
+			admin.POST("/holds/:id/release", adminWrite, adminHandler.ReleaseHold)
+			admin.POST("/holds/:id/extend", adminWrite, adminHandler.ExtendHold)
+			admin.GET("/audit", adminHandler.ListAuditEvents)
+			admin.GET("/integrity/verify", adminHandler.VerifyLogs)
+			admin.GET("/integrity/checkpoints", adminHandler.ListCheckpoints)
+			admin.POST("/integrity/checkpoints", adminWrite, adminHandler.CreateCheckpoint)
+			admin.GET("/downloads", adminHandler.ListDownloads)
+			admin.POST("/downloads/retention", adminWrite, adminHandler.ApplyRetention)
+			admin.GET("/login-attempts", adminHandler.ListLoginAttempts)
+			admin.GET("/settings", adminHandler.GetSettings)
+			admin.PUT("/settings", adminWrite, adminHandler.UpdateSettings)
 		}
 	}
 
-	return router
+	return router, nil
 }
 
 func runMigrations(db *sql.DB, log *logger.Logger) error {
-	migrationSQL, err := os.ReadFile("internal/db/migrations/001_initial_schema.up.sql")
+	paths, err := filepath.Glob("internal/db/migrations/*.up.sql")
 	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
+		return fmt.Errorf("failed to list migration files: %w", err)
 	}
+	sort.Strings(paths)
 
-	_, err = db.Exec(string(migrationSQL))
-	if err != nil {
-		return fmt.Errorf("failed to execute migration: %w", err)
+	for _, path := range paths {
+		migrationSQL, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read migration file: %w", err)
+		}
+
+		_, err = db.Exec(string(migrationSQL))
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %s: %w", filepath.Base(path), err)
+		}
 	}
 
 	log.Info("Migrations executed successfully")
 	return nil
 }
-
@@ -1,22 +1,38 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Storage  StorageConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Auth      AuthConfig
+	Storage   StorageConfig
+	SignedURL SignedURLConfig
+	OIDC      OIDCConfig
+	MFA       MFAConfig
+	Mail      MailConfig
+	Logs      LogsConfig
+
+	// Warnings are configuration problems that do not stop startup, such
+	// as secrets falling back to JWT_SECRET. They are logged at startup.
+	Warnings []string
 }
 
 type ServerConfig struct {
-	Port string
-	Host string
+	Port           string
+	Host           string
+	TrustedProxies []string // IPs or CIDRs whose X-Forwarded-For is believed; none by default
 }
 
 type DatabaseConfig struct {
@@ -29,21 +45,88 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration int //exp in hours
+	Secret            string
+	AccessExpiration  int //exp in minutes
+	RefreshExpiration int //exp in hours
+
+	// Algorithm is HS256 (signed with Secret) or RS256/EdDSA, signed with
+	// generated keys that are rotated every KeyRotation hours and published
+	// at /.well-known/jwks.json.
+	Algorithm        string
+	KeyRotation      int    //rotation period in hours
+	KeyEncryptionKey string // encrypts stored private keys
+	Issuer           string // "iss" claim; omitted when empty
+}
+
+type AuthConfig struct {
+	BootstrapAdminEmail  string // becomes admin once verified; so does the first verified user
+	RequireVerifiedEmail bool   // refuse password logins until the email is verified
+	AppURL               string // frontend base URL used in emailed links
+}
+
+// OIDCConfig enables sign-in through an OpenID provider when Issuer is set.
+type OIDCConfig struct {
+	Issuer          string
+	ClientID        string
+	ClientSecret    string // empty for public clients, which rely on PKCE alone
+	RedirectURL     string // must point at /api/v1/auth/oidc/callback
+	Scopes          []string
+	SuccessRedirect string // optional frontend URL that receives tokens in the fragment
+}
+
+type MFAConfig struct {
+	Issuer        string // name shown in authenticator apps
+	EncryptionKey string // encrypts TOTP secrets at rest
+}
+
+type MailConfig struct {
+	Driver       string // "log" (default) or "smtp"
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// LogsConfig governs the audit and download logs.
+type LogsConfig struct {
+	CheckpointInterval int //minutes between hash chain checkpoints
+
+	// Downloads older than DownloadRetention days are deleted, or with
+	// mode "aggregate" folded into daily counts per file. 0 keeps them.
+	DownloadRetention     int
+	DownloadRetentionMode string
+
+	// Client IPs in the download and share view logs are anonymized after
+	// IPAnonymizeAfter days, by "truncate" (to /24 or /48) or by "hash"
+	// with IPHashKey. 0 keeps them.
+	IPAnonymizeAfter int
+	IPAnonymization  string
+	IPHashKey        string // also keys the hashes used to count unique visitors
 }
 
 type StorageConfig struct {
 	Path string
 }
 
+type SignedURLConfig struct {
+	Keys          []SigningKey // first key signs, all keys verify
+	MaxExpiration int          //max lifetime in seconds
+}
+
+type SigningKey struct {
+	ID     string
+	Secret string
+}
+
 func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Host: getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			TrustedProxies: getEnvList("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -54,12 +137,53 @@ func Load() (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", ""),
-			Expiration: 24,
+			Secret:            getEnv("JWT_SECRET", ""),
+			AccessExpiration:  getEnvInt("JWT_ACCESS_EXPIRATION_MINUTES", 15),
+			RefreshExpiration: getEnvInt("JWT_REFRESH_EXPIRATION_HOURS", 30*24),
+			Algorithm:         getEnv("JWT_ALGORITHM", "HS256"),
+			KeyRotation:       getEnvInt("JWT_KEY_ROTATION_HOURS", 30*24),
+			KeyEncryptionKey:  getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
+			Issuer:            getEnv("JWT_ISSUER", ""),
+		},
+		Auth: AuthConfig{
+			BootstrapAdminEmail:  getEnv("BOOTSTRAP_ADMIN_EMAIL", ""),
+			RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", "false") == "true",
+			AppURL:               strings.TrimSuffix(getEnv("APP_URL", "http://localhost:5173"), "/"),
 		},
 		Storage: StorageConfig{
 			Path: getEnv("STORAGE_PATH", "./storage"),
 		},
+		SignedURL: SignedURLConfig{
+			MaxExpiration: getEnvInt("SIGNED_URL_MAX_EXPIRATION", 7*24*60*60),
+		},
+		OIDC: OIDCConfig{
+			Issuer:          getEnv("OIDC_ISSUER", ""),
+			ClientID:        getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:     getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:          strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+			SuccessRedirect: getEnv("OIDC_SUCCESS_REDIRECT_URL", ""),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Balkan <no-reply@localhost>"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnv("SMTP_PORT", "1025"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		},
+		MFA: MFAConfig{
+			Issuer:        getEnv("MFA_ISSUER", "Balkan"),
+			EncryptionKey: getEnv("MFA_ENCRYPTION_KEY", ""),
+		},
+		Logs: LogsConfig{
+			CheckpointInterval:    getEnvInt("LOG_CHECKPOINT_INTERVAL_MINUTES", 60),
+			DownloadRetention:     getEnvInt("DOWNLOAD_LOG_RETENTION_DAYS", 365),
+			DownloadRetentionMode: getEnv("DOWNLOAD_LOG_RETENTION_MODE", "aggregate"),
+			IPAnonymizeAfter:      getEnvInt("LOG_IP_ANONYMIZE_DAYS", 30),
+			IPAnonymization:       getEnv("LOG_IP_ANONYMIZATION", "truncate"),
+			IPHashKey:             getEnv("LOG_IP_HASH_KEY", ""),
+		},
 	}
 
 	// Validate required fields
@@ -70,9 +194,75 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("JWT_SECRET is required")
 	}
 
+	switch cfg.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("JWT_ALGORITHM must be HS256, RS256 or EdDSA")
+	}
+	if cfg.JWT.KeyRotation <= 0 {
+		return nil, fmt.Errorf("JWT_KEY_ROTATION_HOURS must be positive")
+	}
+	if cfg.JWT.Algorithm != "HS256" && cfg.JWT.KeyEncryptionKey == "" {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY is required with JWT_ALGORITHM=%s", cfg.JWT.Algorithm)
+	}
+
+	if cfg.Logs.CheckpointInterval <= 0 {
+		return nil, fmt.Errorf("LOG_CHECKPOINT_INTERVAL_MINUTES must be positive")
+	}
+	if cfg.Logs.DownloadRetention < 0 || cfg.Logs.IPAnonymizeAfter < 0 {
+		return nil, fmt.Errorf("DOWNLOAD_LOG_RETENTION_DAYS and LOG_IP_ANONYMIZE_DAYS must not be negative")
+	}
+	switch cfg.Logs.DownloadRetentionMode {
+	case "aggregate", "delete":
+	default:
+		return nil, fmt.Errorf("DOWNLOAD_LOG_RETENTION_MODE must be aggregate or delete")
+	}
+	switch cfg.Logs.IPAnonymization {
+	case "truncate", "hash":
+	default:
+		return nil, fmt.Errorf("LOG_IP_ANONYMIZATION must be truncate or hash")
+	}
+	if cfg.Logs.IPHashKey == "" {
+		cfg.Logs.IPHashKey = deriveSecret(cfg.JWT.Secret, "log-ip-hash-key")
+		cfg.warnSharedSecret("LOG_IP_HASH_KEY", "unique visitor counts")
+	}
+
+	keys, err := parseSigningKeys(getEnv("SIGNED_URL_KEYS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("SIGNED_URL_KEYS: %w", err)
+	}
+	if len(keys) == 0 {
+		keys = []SigningKey{{ID: "default", Secret: cfg.JWT.Secret}}
+		cfg.warnSharedSecret("SIGNED_URL_KEYS", "every signed URL issued")
+	}
+	cfg.SignedURL.Keys = keys
+
+	if cfg.MFA.EncryptionKey == "" {
+		cfg.MFA.EncryptionKey = deriveSecret(cfg.JWT.Secret, "mfa-encryption-key")
+		cfg.warnSharedSecret("MFA_ENCRYPTION_KEY", "every MFA enrollment")
+	}
+
+	if cfg.OIDC.Issuer != "" && (cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "") {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+
 	return cfg, nil
 }
 
+// deriveSecret turns JWT_SECRET into a key for one other purpose, so an
+// unset key never reuses the token signing secret itself.
+func deriveSecret(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// warnSharedSecret records that key is unset and JWT_SECRET is used in its
+// place, so rotating JWT_SECRET would also invalidate what the key protects.
+func (c *Config) warnSharedSecret(key, invalidates string) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf("%s is not set and falls back to JWT_SECRET; rotating JWT_SECRET will also invalidate %s", key, invalidates))
+}
+
 func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
@@ -83,4 +273,41 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseSigningKeys parses a comma-separated list of "id:secret" pairs.
+func parseSigningKeys(raw string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid key %q, expected id:secret", pair)
+		}
+		keys = append(keys, SigningKey{ID: id, Secret: secret})
+	}
+	return keys, nil
+}
@@ -0,0 +1,441 @@
+// Package audit records security-relevant actions: who did what to which
+// target, from where.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/hashchain"
+)
+
+// Sign-in and account security.
+const (
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionLogout          = "auth.logout"
+	ActionPasswordChanged = "auth.password_changed"
+	ActionPasswordReset   = "auth.password_reset"
+	ActionMFAEnabled      = "auth.mfa_enabled"
+	ActionMFADisabled     = "auth.mfa_disabled"
+	ActionSessionRevoked  = "auth.session_revoked"
+	ActionAPIKeyCreated   = "auth.api_key_created"
+	ActionAPIKeyRevoked   = "auth.api_key_revoked"
+
+	// ActionImpersonatedRequest is recorded for every request made with an
+	// impersonation token; the actor is the admin.
+	ActionImpersonatedRequest = "auth.impersonated_request"
+)
+
+// Files and sharing.
+const (
+	ActionFileUploaded = "file.uploaded"
+	ActionFileDeleted  = "file.deleted"
+	ActionShareCreated = "share.created"
+	ActionShareRevoked = "share.revoked"
+)
+
+// File requests. A submission targets the request's owner, since the
+// uploader is anonymous.
+const (
+	ActionFileRequestSubmission = "file_request.submission"
+)
+
+// Organization membership.
+const (
+	ActionOrgMemberAdded       = "org.member_added"
+	ActionOrgMemberRoleChanged = "org.member_role_changed"
+	ActionOrgMemberRemoved     = "org.member_removed"
+)
+
+// Actions taken by admins on user accounts.
+const (
+	ActionUserRoleChanged   = "admin.user.role_changed"
+	ActionUserQuotaChanged  = "admin.user.quota_changed"
+	ActionUserSuspended     = "admin.user.suspended"
+	ActionUserUnsuspended   = "admin.user.unsuspended"
+	ActionUserPasswordReset = "admin.user.password_reset"
+	ActionUserDeleted       = "admin.user.deleted"
+	ActionUserLoggedOut     = "admin.user.logged_out"
+	ActionUserImpersonated  = "admin.user.impersonated"
+)
+
+// Other admin actions.
+const (
+	ActionSettingsUpdated  = "admin.settings.updated"
+	ActionOrgQuotaChanged  = "admin.org.quota_changed"
+	ActionRetentionApplied = "admin.logs.retention_applied"
+)
+
+// Content moderation actions.
+const (
+	ActionTakedownCreated = "admin.takedown.created"
+	ActionTakedownLifted  = "admin.takedown.lifted"
+)
+
+// Legal holds and retention locks.
+const (
+	ActionHoldCreated  = "admin.hold.created"
+	ActionHoldReleased = "admin.hold.released"
+	ActionHoldExtended = "admin.hold.extended"
+)
+
+// Target types.
+const (
+	TargetUser     = "user"
+	TargetFile     = "file"
+	TargetShare    = "share"
+	TargetSession  = "session"
+	TargetAPIKey   = "api_key"
+	TargetOrg      = "org"
+	TargetSettings = "settings"
+	TargetTakedown = "takedown"
+	TargetHold     = "hold"
+)
+
+// Details carries action-specific data, stored as JSON.
+type Details map[string]interface{}
+
+type Event struct {
+	ID         uuid.UUID  `json:"id"`
+	ActorID    *uuid.UUID `json:"actor_id,omitempty"` // nil for anonymous or system actions
+	ActorEmail string     `json:"actor_email,omitempty"`
+	Action     string     `json:"action"`
+	TargetType string     `json:"target_type,omitempty"`
+	TargetID   string     `json:"target_id,omitempty"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	RequestID  string     `json:"request_id,omitempty"`
+	Details    Details    `json:"details,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Chain names the audit log's hash chain.
+const Chain = "audit"
+
+// chainFields are the contents an event's hash covers. details must be
+// canonical JSON.
+func (e *Event) chainFields(details string) []string {
+	actorID := ""
+	if e.ActorID != nil {
+		actorID = e.ActorID.String()
+	}
+	return []string{e.ID.String(), actorID, e.Action, e.TargetType, e.TargetID,
+		e.IPAddress, e.UserAgent, e.RequestID, details, hashchain.Time(e.CreatedAt)}
+}
+
+// Record appends e to the log, filling in its ID and time if unset, and
+// links it into the hash chain.
+func (r *Repository) Record(e *Event) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.Truncate(time.Microsecond)
+	if e.Details == nil {
+		e.Details = Details{}
+	}
+	raw, err := json.Marshal(e.Details)
+	if err != nil {
+		return errors.Wrap(500, "failed to encode audit details", err)
+	}
+	details, err := hashchain.CanonicalJSON(raw)
+	if err != nil {
+		return errors.Wrap(500, "failed to encode audit details", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to record audit event", err)
+	}
+	defer tx.Rollback()
+
+	if err := hashchain.Lock(tx, Chain); err != nil {
+		return errors.Wrap(500, "failed to lock audit chain", err)
+	}
+	head, err := hashchain.Head(tx, "audit_events")
+	if err != nil {
+		return errors.Wrap(500, "failed to read audit chain", err)
+	}
+	link := hashchain.Next(head, e.chainFields(details)...)
+
+	query := `
+		INSERT INTO audit_events (id, actor_id, action, target_type, target_id, ip_address, user_agent, request_id, details, created_at,
+		                          seq, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err = tx.Exec(query, e.ID, e.ActorID, e.Action, e.TargetType, e.TargetID,
+		e.IPAddress, e.UserAgent, e.RequestID, details, e.CreatedAt, link.Seq, link.PrevHash, link.Hash)
+	if err != nil {
+		return errors.Wrap(500, "failed to record audit event", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to record audit event", err)
+	}
+	return nil
+}
+
+// ChainHead returns the last event in the hash chain, or nil if the log is
+// empty.
+func (r *Repository) ChainHead() (*hashchain.Link, error) {
+	head, err := hashchain.Head(r.db, "audit_events")
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to read audit chain", err)
+	}
+	return head, nil
+}
+
+const chainColumns = `id, actor_id, action, target_type, target_id, ip_address, user_agent, request_id, details, created_at`
+
+func scanChained(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Event, string, error) {
+	e := &Event{}
+	var actorID uuid.NullUUID
+	var raw []byte
+	dest := append([]interface{}{&e.ID, &actorID, &e.Action, &e.TargetType, &e.TargetID,
+		&e.IPAddress, &e.UserAgent, &e.RequestID, &raw, &e.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, "", err
+	}
+	if actorID.Valid {
+		e.ActorID = &actorID.UUID
+	}
+	details, err := hashchain.CanonicalJSON(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	return e, details, nil
+}
+
+// LinkUnchained adds events recorded before the log was chained, oldest
+// first. It returns how many were linked.
+func (r *Repository) LinkUnchained() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to link audit events", err)
+	}
+	defer tx.Rollback()
+
+	if err := hashchain.Lock(tx, Chain); err != nil {
+		return 0, errors.Wrap(500, "failed to lock audit chain", err)
+	}
+	head, err := hashchain.Head(tx, "audit_events")
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to read audit chain", err)
+	}
+
+	rows, err := tx.Query(`SELECT ` + chainColumns + ` FROM audit_events WHERE seq IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to list unchained audit events", err)
+	}
+	var links []hashchain.Link
+	var ids []uuid.UUID
+	for rows.Next() {
+		e, details, err := scanChained(rows)
+		if err != nil {
+			rows.Close()
+			return 0, errors.Wrap(500, "failed to scan audit event", err)
+		}
+		link := hashchain.Next(head, e.chainFields(details)...)
+		head = &link
+		links = append(links, link)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+
+	for i, link := range links {
+		_, err := tx.Exec(`UPDATE audit_events SET seq = $1, prev_hash = $2, hash = $3 WHERE id = $4`,
+			link.Seq, link.PrevHash, link.Hash, ids[i])
+		if err != nil {
+			return 0, errors.Wrap(500, "failed to link audit event", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(500, "failed to link audit events", err)
+	}
+	return len(links), nil
+}
+
+// EachLinked calls fn for every chained event in sequence order, with the
+// contents its hash should cover.
+func (r *Repository) EachLinked(fn func(hashchain.Record) error) error {
+	rows, err := r.db.Query(`SELECT ` + chainColumns + `, seq, prev_hash, hash FROM audit_events WHERE seq IS NOT NULL ORDER BY seq`)
+	if err != nil {
+		return errors.Wrap(500, "failed to read audit chain", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link hashchain.Link
+		e, details, err := scanChained(rows, &link.Seq, &link.PrevHash, &link.Hash)
+		if err != nil {
+			return errors.Wrap(500, "failed to scan audit event", err)
+		}
+		if err := fn(hashchain.Record{ID: e.ID.String(), Link: link, Fields: e.chainFields(details)}); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(500, "failed to read audit chain", err)
+	}
+	return nil
+}
+
+// CountUnchained returns how many events are outside the chain. After
+// LinkUnchained has run, any such event was written around the
+// application.
+func (r *Repository) CountUnchained() (int, error) {
+	var n int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_events WHERE seq IS NULL`).Scan(&n); err != nil {
+		return 0, errors.Wrap(500, "failed to count unchained audit events", err)
+	}
+	return n, nil
+}
+
+// Query filters the audit log. UserID matches events a user took or that
+// targeted their account. An Action ending in "." matches every action
+// with that prefix, such as "auth." or "admin.user.".
+type Query struct {
+	UserID     *uuid.UUID `form:"-"`
+	ActorID    *uuid.UUID `form:"-"`
+	Action     string     `form:"action"`
+	TargetType string     `form:"target_type"`
+	TargetID   string     `form:"target_id"`
+	IP         string     `form:"ip"`
+	From       *time.Time `form:"from"`
+	To         *time.Time `form:"to"`
+	Page       int        `form:"page"`
+	PageSize   int        `form:"page_size"`
+}
+
+// MaxExport caps how many events one export returns.
+const MaxExport = 100000
+
+const eventColumns = `e.id, e.actor_id, COALESCE(u.email, ''), e.action, e.target_type, e.target_id,
+	e.ip_address, e.user_agent, e.request_id, e.details, e.created_at`
+
+func (q *Query) filter() (string, []interface{}) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.UserID != nil {
+		args = append(args, *q.UserID)
+		where = append(where, fmt.Sprintf("(e.actor_id = $%[1]d OR (e.target_type = 'user' AND e.target_id = $%[1]d::text))", len(args)))
+	}
+	if q.ActorID != nil {
+		args = append(args, *q.ActorID)
+		where = append(where, fmt.Sprintf("e.actor_id = $%d", len(args)))
+	}
+	if q.Action != "" {
+		args = append(args, q.Action)
+		if strings.HasSuffix(q.Action, ".") {
+			where = append(where, fmt.Sprintf("left(e.action, length($%[1]d)) = $%[1]d", len(args)))
+		} else {
+			where = append(where, fmt.Sprintf("e.action = $%d", len(args)))
+		}
+	}
+	if q.TargetType != "" {
+		args = append(args, q.TargetType)
+		where = append(where, fmt.Sprintf("e.target_type = $%d", len(args)))
+	}
+	if q.TargetID != "" {
+		args = append(args, q.TargetID)
+		where = append(where, fmt.Sprintf("e.target_id = $%d", len(args)))
+	}
+	if q.IP != "" {
+		args = append(args, q.IP)
+		where = append(where, fmt.Sprintf("e.ip_address = $%d", len(args)))
+	}
+	if q.From != nil {
+		args = append(args, *q.From)
+		where = append(where, fmt.Sprintf("e.created_at >= $%d", len(args)))
+	}
+	if q.To != nil {
+		args = append(args, *q.To)
+		where = append(where, fmt.Sprintf("e.created_at < $%d", len(args)))
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// List returns one page of matching events, newest first, and the total
+// number of matches.
+func (r *Repository) List(q *Query) ([]*Event, int, error) {
+	filter, args := q.filter()
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_events e WHERE `+filter, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(500, "failed to count audit events", err)
+	}
+
+	events := []*Event{}
+	args = append(args, q.PageSize, (q.Page-1)*q.PageSize)
+	err := r.each(fmt.Sprintf(`%s LIMIT $%d OFFSET $%d`, selectEvents(filter), len(args)-1, len(args)), args, func(e *Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Each calls fn for every matching event, newest first, up to MaxExport.
+// Events are streamed rather than loaded at once.
+func (r *Repository) Each(q *Query, fn func(*Event) error) error {
+	filter, args := q.filter()
+	args = append(args, MaxExport)
+	return r.each(fmt.Sprintf(`%s LIMIT $%d`, selectEvents(filter), len(args)), args, fn)
+}
+
+func selectEvents(filter string) string {
+	return `
+		SELECT ` + eventColumns + `
+		FROM audit_events e
+		LEFT JOIN users u ON u.id = e.actor_id
+		WHERE ` + filter + `
+		ORDER BY e.created_at DESC, e.id`
+}
+
+func (r *Repository) each(query string, args []interface{}, fn func(*Event) error) error {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return errors.Wrap(500, "failed to list audit events", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &Event{}
+		var actorID uuid.NullUUID
+		var details []byte
+		if err := rows.Scan(&e.ID, &actorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID,
+			&e.IPAddress, &e.UserAgent, &e.RequestID, &details, &e.CreatedAt); err != nil {
+			return errors.Wrap(500, "failed to scan audit event", err)
+		}
+		if actorID.Valid {
+			e.ActorID = &actorID.UUID
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return errors.Wrap(500, "failed to decode audit details", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(500, "failed to list audit events", err)
+	}
+	return nil
+}
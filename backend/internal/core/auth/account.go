@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/logger"
+	"github.com/samridh-111/balkan_task/internal/pkg/mailer"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+	mailThrottle     = time.Minute
+)
+
+var (
+	ErrInvalidUserToken = errors.New(400, "invalid or expired token")
+	ErrWrongPassword    = errors.New(401, "current password is incorrect")
+)
+
+// AccountService runs the self-service account flows that prove control of
+// an email address: verification, password reset and password change.
+type AccountService struct {
+	auth   *AuthService
+	mailer mailer.Mailer
+	appURL string
+	log    *logger.Logger
+}
+
+func NewAccountService(authService *AuthService, m mailer.Mailer, appURL string, log *logger.Logger) *AccountService {
+	return &AccountService{auth: authService, mailer: m, appURL: appURL, log: log}
+}
+
+// SendVerificationEmail mails a verification link unless the address is
+// already verified or a link was sent moments ago.
+func (s *AccountService) SendVerificationEmail(userID uuid.UUID) error {
+	user, err := s.auth.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return errors.New(409, "email already verified")
+	}
+
+	tok, err := s.issueToken(user.ID, TokenVerifyEmail, verifyEmailTTL)
+	if err != nil || tok == "" {
+		return err
+	}
+
+	s.send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm that this is your address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			s.link("/verify-email", tok), verifyEmailTTL),
+	})
+	return nil
+}
+
+func (s *AccountService) VerifyEmail(tok string) error {
+	userID, err := s.auth.tokens.ConsumeUserToken(token.Hash(tok), TokenVerifyEmail)
+	if err == errors.ErrNotFound {
+		return ErrInvalidUserToken
+	}
+	if err != nil {
+		return err
+	}
+	return s.auth.userRepo.MarkEmailVerified(userID, s.auth.bootstrapAdminEmail)
+}
+
+// RequestPasswordReset mails a reset link if an account exists for email.
+// Callers always report success so the endpoint cannot be used to find out
+// which addresses are registered.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	user, err := s.auth.userRepo.GetByEmail(email)
+	if err == errors.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tok, err := s.issueToken(user.ID, TokenResetPassword, resetPasswordTTL)
+	if err != nil || tok == "" {
+		return err
+	}
+
+	s.send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account. If it was you, open the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			s.link("/reset-password", tok), resetPasswordTTL),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and signs the user
+// out everywhere. Completing a reset also proves control of the address.
+// It returns the user whose password was reset.
+func (s *AccountService) ResetPassword(req *users.ResetPasswordRequest) (uuid.UUID, error) {
+	userID, err := s.auth.tokens.ConsumeUserToken(token.Hash(req.Token), TokenResetPassword)
+	if err == errors.ErrNotFound {
+		return uuid.Nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := s.setPassword(userID, req.Password, uuid.Nil); err != nil {
+		return uuid.Nil, err
+	}
+	if err := s.auth.tokens.InvalidateUserTokens(userID, TokenResetPassword); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, s.auth.userRepo.MarkEmailVerified(userID, s.auth.bootstrapAdminEmail)
+}
+
+// AdminResetPassword is a reset forced by an admin: the current password
+// stops working at once, every session ends, and the user is mailed a link
+// to choose a new one. Any earlier reset link is voided.
+func (s *AccountService) AdminResetPassword(userID uuid.UUID) error {
+	user, err := s.auth.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.auth.userRepo.UpdatePassword(user.ID, ""); err != nil {
+		return err
+	}
+	if err := s.auth.tokens.RevokeUserSessions(user.ID, uuid.Nil); err != nil {
+		return err
+	}
+	if err := s.auth.tokens.InvalidateUserTokens(user.ID, TokenResetPassword); err != nil {
+		return err
+	}
+
+	tok := token.New(32)
+	if err := s.auth.tokens.CreateUserToken(user.ID, TokenResetPassword, token.Hash(tok), time.Now().Add(resetPasswordTTL)); err != nil {
+		return err
+	}
+	s.send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was reset",
+		Body: fmt.Sprintf("An administrator reset the password for this account. Choose a new one here:\n\n%s\n\n"+
+			"The link expires in %s. After that, use \"Forgot password\" to get a new one.\n",
+			s.link("/reset-password", tok), resetPasswordTTL),
+	})
+	return nil
+}
+
+// ChangePassword replaces the password of a signed-in user and signs out
+// every other session. The session making the change stays signed in.
+func (s *AccountService) ChangePassword(claims *Claims, req *users.ChangePasswordRequest) error {
+	user, err := s.auth.userRepo.GetByID(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+
+	return s.setPassword(user.ID, req.NewPassword, claims.SessionID)
+}
+
+func (s *AccountService) setPassword(userID uuid.UUID, password string, keepSession uuid.UUID) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return errors.Wrap(500, "failed to hash password", err)
+	}
+	if err := s.auth.userRepo.UpdatePassword(userID, hash); err != nil {
+		return err
+	}
+	return s.auth.tokens.RevokeUserSessions(userID, keepSession)
+}
+
+// issueToken stores a new single-use token and returns it. It returns ""
+// without error when one was issued within mailThrottle, so repeated
+// requests cannot flood a mailbox.
+func (s *AccountService) issueToken(userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	recent, err := s.auth.tokens.UserTokenIssuedSince(userID, purpose, time.Now().Add(-mailThrottle))
+	if err != nil || recent {
+		return "", err
+	}
+
+	tok := token.New(32)
+	if err := s.auth.tokens.CreateUserToken(userID, purpose, token.Hash(tok), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return tok, nil
+}
+
+func (s *AccountService) link(path, tok string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(tok)
+}
+
+// send delivers in the background so slow mail servers do not hold up the
+// request, and response times do not reveal whether an account exists.
+func (s *AccountService) send(msg *mailer.Message) {
+	go func() {
+		if err := s.mailer.Send(msg); err != nil {
+			s.log.Error("Failed to send mail: %v", err)
+		}
+	}()
+}
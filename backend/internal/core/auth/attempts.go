@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Outcomes recorded for a login attempt.
+const (
+	AttemptSuccess            = "success"
+	AttemptInvalidCredentials = "invalid_credentials"
+	AttemptEmailNotVerified   = "email_not_verified"
+	AttemptThrottled          = "throttled"
+	AttemptAccountSuspended   = "account_suspended"
+)
+
+const (
+	// Failures older than this no longer count towards a delay.
+	throttleWindow = 15 * time.Minute
+
+	// Per account: progressive delays from accountDelayAfter failures,
+	// then a lockout for the rest of the window.
+	accountDelayAfter = 3
+	accountLockAfter  = 10
+
+	// Per IP the limits are higher, since one address may serve many users.
+	ipDelayAfter = 10
+	ipLockAfter  = 50
+
+	maxDelay         = time.Minute
+	attemptRetention = 30 * 24 * time.Hour
+)
+
+// ClientInfo identifies where a login comes from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginAttempt is one recorded password login.
+type LoginAttempt struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	Success   bool       `json:"success"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type LoginAttemptQuery struct {
+	Email      string `form:"email"`
+	IP         string `form:"ip"`
+	FailedOnly bool   `form:"failed_only"`
+	Limit      int    `form:"limit"`
+}
+
+// LoginThrottledError rejects a login until RetryAfter has passed.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (r *LoginAttemptRepository) Record(a *LoginAttempt) error {
+	return recordAttempt(r.db, a)
+}
+
+func recordAttempt(q querier, a *LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (id, email, user_id, ip_address, user_agent, success, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := q.Exec(query, a.ID, a.Email, a.UserID, a.IPAddress, a.UserAgent, a.Success, a.Reason, a.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to record login attempt", err)
+	}
+	if !a.Success {
+		if _, err := q.Exec(`DELETE FROM login_attempts WHERE created_at < $1`, time.Now().Add(-attemptRetention)); err != nil {
+			return errors.Wrap(500, "failed to prune login attempts", err)
+		}
+	}
+	return nil
+}
+
+// accountFailures counts wrong passwords for email since the later of
+// since and the account's last successful login.
+func accountFailures(q querier, email string, since time.Time) (int, time.Time, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE email = $1 AND reason = $2 AND created_at > GREATEST($3, COALESCE(
+			(SELECT MAX(created_at) FROM login_attempts WHERE email = $1 AND success), $3))
+	`
+	return countFailures(q, query, email, since)
+}
+
+// ipFailures counts wrong passwords from ip since since. A success does
+// not reset it, or one valid account would cover for guessing at others.
+func ipFailures(q querier, ip string, since time.Time) (int, time.Time, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND reason = $2 AND created_at > $3
+	`
+	return countFailures(q, query, ip, since)
+}
+
+func countFailures(q querier, query, key string, since time.Time) (int, time.Time, error) {
+	var count int
+	var last sql.NullTime
+	if err := q.QueryRow(query, key, AttemptInvalidCredentials, since).Scan(&count, &last); err != nil {
+		return 0, time.Time{}, errors.Wrap(500, "failed to count login attempts", err)
+	}
+	return count, last.Time, nil
+}
+
+func (r *LoginAttemptRepository) List(q *LoginAttemptQuery) ([]*LoginAttempt, error) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.Email != "" {
+		args = append(args, strings.ToLower(q.Email))
+		where = append(where, fmt.Sprintf("email = $%d", len(args)))
+	}
+	if q.IP != "" {
+		args = append(args, q.IP)
+		where = append(where, fmt.Sprintf("ip_address = $%d", len(args)))
+	}
+	if q.FailedOnly {
+		where = append(where, "NOT success")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, email, user_id, ip_address, COALESCE(user_agent, ''), success, reason, created_at
+		FROM login_attempts
+		WHERE %s
+		ORDER BY created_at DESC
+		LIMIT $%d
+	`, strings.Join(where, " AND "), len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list login attempts", err)
+	}
+	defer rows.Close()
+
+	attempts := []*LoginAttempt{}
+	for rows.Next() {
+		a := &LoginAttempt{}
+		var userID uuid.NullUUID
+		if err := rows.Scan(&a.ID, &a.Email, &userID, &a.IPAddress, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan login attempt", err)
+		}
+		if userID.Valid {
+			a.UserID = &userID.UUID
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+// LoginThrottle slows down and then locks out password guessing, tracked
+// separately per account and per client IP. State lives in the database so
+// it holds across restarts and multiple API instances.
+type LoginThrottle struct {
+	attempts *LoginAttemptRepository
+}
+
+func NewLoginThrottle(attempts *LoginAttemptRepository) *LoginThrottle {
+	return &LoginThrottle{attempts: attempts}
+}
+
+// Attempt runs a password check for email from client and records its
+// outcome. attempt returns the user the email matched, if any, the
+// outcome to record, and the error for the caller; an empty outcome
+// records nothing. Attempts for one account run one at a time under a
+// lock, so concurrent guesses cannot all pass the throttle before any of
+// them is counted. A throttled attempt returns a *LoginThrottledError
+// without calling attempt.
+func (t *LoginThrottle) Attempt(email string, client ClientInfo, attempt func() (*uuid.UUID, string, error)) error {
+	tx, err := t.attempts.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('login:' || $1))`, email); err != nil {
+		return errors.Wrap(500, "failed to lock login attempts", err)
+	}
+
+	wait, err := t.wait(tx, email, client)
+	if err != nil {
+		return err
+	}
+
+	var userID *uuid.UUID
+	var reason string
+	var result error
+	if wait > 0 {
+		reason, result = AttemptThrottled, &LoginThrottledError{RetryAfter: wait}
+	} else {
+		userID, reason, result = attempt()
+	}
+
+	if reason != "" {
+		if err := t.record(tx, email, userID, client, reason); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(500, "failed to record login attempt", err)
+		}
+	}
+	return result
+}
+
+// wait returns how long a login for email from client must wait.
+func (t *LoginThrottle) wait(q querier, email string, client ClientInfo) (time.Duration, error) {
+	now := time.Now()
+	since := now.Add(-throttleWindow)
+
+	count, last, err := accountFailures(q, email, since)
+	if err != nil {
+		return 0, err
+	}
+	wait := retryAfter(count, last, accountDelayAfter, accountLockAfter, now)
+
+	count, last, err = ipFailures(q, client.IP, since)
+	if err != nil {
+		return 0, err
+	}
+	if w := retryAfter(count, last, ipDelayAfter, ipLockAfter, now); w > wait {
+		wait = w
+	}
+	return wait, nil
+}
+
+// record stores the outcome of an attempt. userID is nil when the email
+// did not match an account.
+func (t *LoginThrottle) record(q querier, email string, userID *uuid.UUID, client ClientInfo, reason string) error {
+	return recordAttempt(q, &LoginAttempt{
+		ID:        uuid.New(),
+		Email:     email,
+		UserID:    userID,
+		IPAddress: client.IP,
+		UserAgent: client.UserAgent,
+		Success:   reason == AttemptSuccess,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+}
+
+// retryAfter computes the remaining wait after failures, the last at last.
+// The delay doubles with each failure past delayAfter, capped at maxDelay;
+// from lockAfter failures the key is locked until the window has passed.
+func retryAfter(failures int, last time.Time, delayAfter, lockAfter int, now time.Time) time.Duration {
+	if failures < delayAfter {
+		return 0
+	}
+
+	var until time.Time
+	if failures >= lockAfter {
+		until = last.Add(throttleWindow)
+	} else {
+		delay := time.Second << uint(failures-delayAfter)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		until = last.Add(delay)
+	}
+
+	if wait := until.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -7,50 +7,197 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
-	Role   string    `json:"role"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	SessionID uuid.UUID `json:"sid"`               // refresh token family the token was issued for
+	Purpose   string    `json:"purpose,omitempty"` // set on restricted tokens, which are not access tokens
+	Act       *Actor    `json:"act,omitempty"`     // set when an admin is acting as this user
 	jwt.RegisteredClaims
+
+	// Set only when the request was authenticated with an API key; never
+	// part of a signed token.
+	APIKeyID uuid.UUID `json:"-"`
+	Scopes   []string  `json:"-"`
+}
+
+// Actor is the admin behind an impersonation token, after the "act" claim
+// of RFC 8693. Unless AllowWrites is set the token may only read.
+type Actor struct {
+	UserID      uuid.UUID `json:"sub"`
+	Email       string    `json:"email"`
+	AllowWrites bool      `json:"allow_writes,omitempty"`
+}
+
+// Impersonated reports whether the claims were issued to an admin acting
+// as the user.
+func (c *Claims) Impersonated() bool {
+	return c.Act != nil
+}
+
+// AllowsScope reports whether the credential behind the claims may be used
+// for scope. Access tokens carry the full authority of the user's role; API
+// keys are limited to the scopes chosen when they were created, and
+// impersonation tokens to reading unless writes were allowed.
+func (c *Claims) AllowsScope(scope string) bool {
+	if c.Act != nil && !c.Act.AllowWrites && !rbac.ReadOnly(rbac.Permission(scope)) {
+		return false
+	}
+	if c.APIKeyID == uuid.Nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 type Service struct {
-	secret     string
-	expiration time.Duration
+	secret            string
+	keys              *KeyStore // nil when tokens are signed with the HS256 secret
+	issuer            string
+	expiration        time.Duration
+	refreshExpiration time.Duration
 }
 
-func NewService(cfg *config.Config) *Service {
+// NewService signs with keys when given, and with the shared JWT secret
+// (HS256) otherwise.
+func NewService(cfg *config.Config, keys *KeyStore) *Service {
 	return &Service{
-		secret:     cfg.JWT.Secret,
-		expiration: time.Duration(cfg.JWT.Expiration) * time.Hour,
+		secret:            cfg.JWT.Secret,
+		keys:              keys,
+		issuer:            cfg.JWT.Issuer,
+		expiration:        time.Duration(cfg.JWT.AccessExpiration) * time.Minute,
+		refreshExpiration: time.Duration(cfg.JWT.RefreshExpiration) * time.Hour,
 	}
 }
 
-func (s *Service) GenerateToken(userID uuid.UUID, email, role string) (string, error) {
+// GenerateToken issues a short-lived access token with a unique ID (jti) so
+// it can be revoked before it expires.
+func (s *Service) GenerateToken(userID uuid.UUID, email, role string, sessionID uuid.UUID) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.expiration)
+	claims := &Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    s.issuer,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	signed, err := s.sign(claims)
+	return signed, expiresAt, err
+}
+
+// GeneratePurposeToken issues a token that only the endpoint for purpose
+// accepts, such as the second step of an MFA login.
+func (s *Service) GeneratePurposeToken(userID uuid.UUID, email, role, purpose string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := &Claims{
+		UserID:  userID,
+		Email:   email,
+		Role:    role,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    s.issuer,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	signed, err := s.sign(claims)
+	return signed, expiresAt, err
+}
+
+// GenerateImpersonationToken issues an access token for a user that names
+// the admin acting as them. It belongs to no session, so it cannot be
+// refreshed and ends when it expires or is revoked.
+func (s *Service) GenerateImpersonationToken(userID uuid.UUID, email, role string, actor *Actor, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := &Claims{
 		UserID: userID,
 		Email:  email,
 		Role:   role,
+		Act:    actor,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			Issuer:    s.issuer,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.secret))
+	signed, err := s.sign(claims)
+	return signed, expiresAt, err
 }
 
-func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+// RefreshExpiration is the lifetime of a refresh token.
+func (s *Service) RefreshExpiration() time.Duration {
+	return s.refreshExpiration
+}
+
+// JWKS returns the public verification keys, or false when tokens are
+// signed with the shared secret and there is nothing to publish.
+func (s *Service) JWKS() (*JWKSet, bool) {
+	if s.keys == nil {
+		return nil, false
+	}
+	return s.keys.JWKS(), true
+}
+
+func (s *Service) sign(claims *Claims) (string, error) {
+	if s.keys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.secret))
+	}
+	key := s.keys.current()
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// verificationKey picks the key for a token by its kid header. Only the
+// configured algorithm is accepted, so an HS256 token can never be checked
+// against a public key or the reverse.
+func (s *Service) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s.keys == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
 		}
 		return []byte(s.secret), nil
-	})
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys.lookup(kid)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("invalid signing method")
+	}
+	return key.private.Public(), nil
+}
+
+func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{}
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.issuer))
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.verificationKey, opts...)
 
 	if err != nil {
 		return nil, err
@@ -72,4 +219,3 @@ func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
-
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/logger"
+	"github.com/samridh-111/balkan_task/internal/pkg/secretbox"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+// JWT signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits = 2048
+
+	// A new key is published this long before it starts signing, so
+	// verifiers that cache the JWKS know it before they see tokens.
+	keyPublishLead = time.Hour
+
+	// A superseded key keeps verifying for the longest token lifetime
+	// plus this margin.
+	keyRetentionMargin = time.Hour
+
+	// Derives the key that encrypts stored private keys from
+	// JWT_KEY_ENCRYPTION_KEY. Keys stored by earlier versions were sealed
+	// under the TOTP secret purpose and are still read.
+	signingKeyPurpose       = "jwt-signing-key"
+	legacySigningKeyPurpose = "mfa-secret"
+
+	keyRefreshInterval = time.Minute
+
+	// Serializes rotation across API instances.
+	keyRotationLockID = 0x6a776b73
+)
+
+// JWTKey is an asymmetric key pair used to sign and verify tokens.
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	NotBefore time.Time // starts signing
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+func (k *JWTKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// JWK is the public half of a key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *JWTKey) jwk() JWK {
+	out := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		out.Kty = "RSA"
+		out.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		out.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		out.Kty = "OKP"
+		out.Crv = "Ed25519"
+		out.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return out
+}
+
+type storedKey struct {
+	JWTKey
+	sealed string
+}
+
+type SigningKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSigningKeyRepository(db *sql.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+func (r *SigningKeyRepository) ListKeys(algorithm string) ([]*storedKey, error) {
+	query := `
+		SELECT kid, algorithm, private_key, not_before, created_at
+		FROM jwt_signing_keys
+		WHERE algorithm = $1
+		ORDER BY not_before
+	`
+	rows, err := r.db.Query(query, algorithm)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list signing keys", err)
+	}
+	defer rows.Close()
+
+	var keys []*storedKey
+	for rows.Next() {
+		k := &storedKey{}
+		if err := rows.Scan(&k.ID, &k.Algorithm, &k.sealed, &k.NotBefore, &k.CreatedAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan signing key", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// CreateKeyUnlessScheduled stores k unless another instance has meanwhile
+// added a key starting after latest, the newest key the caller knew of. It
+// reports whether k was stored.
+func (r *SigningKeyRepository) CreateKeyUnlessScheduled(k *JWTKey, sealed string, latest time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, keyRotationLockID); err != nil {
+		return false, errors.Wrap(500, "failed to lock signing keys", err)
+	}
+
+	var scheduled int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM jwt_signing_keys WHERE algorithm = $1 AND not_before > $2`,
+		k.Algorithm, latest).Scan(&scheduled)
+	if err != nil {
+		return false, errors.Wrap(500, "failed to check signing keys", err)
+	}
+	if scheduled > 0 {
+		return false, nil
+	}
+
+	query := `
+		INSERT INTO jwt_signing_keys (kid, algorithm, private_key, not_before, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(query, k.ID, k.Algorithm, sealed, k.NotBefore, k.CreatedAt); err != nil {
+		return false, errors.Wrap(500, "failed to create signing key", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(500, "failed to commit signing key", err)
+	}
+	return true, nil
+}
+
+func (r *SigningKeyRepository) DeleteKey(kid string) error {
+	if _, err := r.db.Exec(`DELETE FROM jwt_signing_keys WHERE kid = $1`, kid); err != nil {
+		return errors.Wrap(500, "failed to delete signing key", err)
+	}
+	return nil
+}
+
+// KeyStore holds the signing keys for RS256 or EdDSA. Keys live in the
+// database so every API instance signs with the same key; each instance
+// reloads them every minute, and whichever notices first creates the next
+// key when a rotation is due.
+type KeyStore struct {
+	repo      *SigningKeyRepository
+	box       *secretbox.Box
+	legacyBox *secretbox.Box
+	algorithm string
+	rotation  time.Duration
+	retention time.Duration
+	log       *logger.Logger
+
+	mu   sync.RWMutex
+	keys []*JWTKey // ordered by NotBefore
+}
+
+// NewKeyStore loads the keys, creating the first one if there is none.
+func NewKeyStore(repo *SigningKeyRepository, cfg *config.JWTConfig, log *logger.Logger) (*KeyStore, error) {
+	s := &KeyStore{
+		repo:      repo,
+		box:       secretbox.New(cfg.KeyEncryptionKey, signingKeyPurpose),
+		legacyBox: secretbox.New(cfg.KeyEncryptionKey, legacySigningKeyPurpose),
+		algorithm: cfg.Algorithm,
+		rotation:  time.Duration(cfg.KeyRotation) * time.Hour,
+		retention: time.Duration(cfg.AccessExpiration)*time.Minute + keyRetentionMargin,
+		log:       log,
+	}
+	if err := s.refresh(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start rotates and reloads the keys in the background.
+func (s *KeyStore) Start() {
+	ticker := time.NewTicker(keyRefreshInterval)
+	go func() {
+		for range ticker.C {
+			if err := s.refresh(time.Now()); err != nil {
+				s.log.Error("Failed to refresh JWT signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+// refresh creates the next key when a rotation is due, drops keys that no
+// token can still use, and reloads the rest.
+func (s *KeyStore) refresh(now time.Time) error {
+	stored, err := s.repo.ListKeys(s.algorithm)
+	if err != nil {
+		return err
+	}
+
+	var latest, next time.Time
+	if len(stored) == 0 {
+		next = now
+	} else {
+		latest = stored[len(stored)-1].NotBefore
+		if !now.Before(latest.Add(s.rotation - keyPublishLead)) {
+			next = latest.Add(s.rotation)
+			if earliest := now.Add(keyPublishLead); next.Before(earliest) {
+				next = earliest
+			}
+		}
+	}
+	if !next.IsZero() {
+		created, err := s.createKey(next, latest, now)
+		if err != nil {
+			return err
+		}
+		if created != nil {
+			s.log.Info("Scheduled JWT signing key %s from %s", created.ID, next.UTC().Format(time.RFC3339))
+		}
+		if stored, err = s.repo.ListKeys(s.algorithm); err != nil {
+			return err
+		}
+	}
+
+	var keys []*JWTKey
+	for i, k := range stored {
+		if i+1 < len(stored) && now.After(stored[i+1].NotBefore.Add(s.retention)) {
+			if err := s.repo.DeleteKey(k.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		der, err := s.box.Open(k.sealed)
+		if err != nil {
+			der, err = s.legacyBox.Open(k.sealed)
+		}
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		private, err := x509.ParsePKCS8PrivateKey([]byte(der))
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("signing key %s: unsupported key type %T", k.ID, private)
+		}
+		key := k.JWTKey
+		key.private = signer
+		keys = append(keys, &key)
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// createKey generates a key that signs from notBefore. It returns nil if
+// another instance got there first.
+func (s *KeyStore) createKey(notBefore, latest, now time.Time) (*JWTKey, error) {
+	var private crypto.Signer
+	var err error
+	switch s.algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", s.algorithm)
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to generate signing key", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to encode signing key", err)
+	}
+
+	key := &JWTKey{
+		ID:        now.UTC().Format("20060102") + "-" + token.New(6),
+		Algorithm: s.algorithm,
+		NotBefore: notBefore,
+		CreatedAt: now,
+		private:   private,
+	}
+	created, err := s.repo.CreateKeyUnlessScheduled(key, s.box.Seal(string(der)), latest)
+	if err != nil || !created {
+		return nil, err
+	}
+	return key, nil
+}
+
+// current returns the key to sign with: the newest one already in effect.
+func (s *KeyStore) current() *JWTKey {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].NotBefore.After(now) {
+			return s.keys[i]
+		}
+	}
+	// Only reachable with a clock behind the one that scheduled the key.
+	return s.keys[0]
+}
+
+func (s *KeyStore) lookup(kid string) (*JWTKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS returns the public keys of every key that is scheduled, signing, or
+// still verifying tokens it signed earlier.
+func (s *KeyStore) JWKS() *JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := &JWKSet{Keys: make([]JWK, 0, len(s.keys))}
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		set.Keys = append(set.Keys, s.keys[i].jwk())
+	}
+	return set
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/core/mfa"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/core/settings"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/secretbox"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+	"github.com/skip2/go-qrcode"
+)
+
+// Purposes of restricted tokens issued during an MFA login.
+const (
+	PurposeMFA       = "mfa"        // password accepted, second factor pending
+	PurposeMFAEnroll = "mfa_enroll" // password accepted, must enroll first
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	mfaMaxAttempts    = 5
+	mfaLockout        = 15 * time.Minute
+	recoveryCodeCount = 10
+	qrCodeScale       = 6 // pixels per QR module; negative sizes ask go-qrcode for a scale
+
+	// Derives the key that encrypts TOTP secrets from MFA_ENCRYPTION_KEY.
+	mfaSecretPurpose = "mfa-secret"
+)
+
+var (
+	ErrInvalidMFACode    = errors.New(401, "invalid verification code")
+	ErrMFALocked         = errors.New(429, "too many failed verification attempts, try again later")
+	ErrMFANotEnabled     = errors.New(400, "mfa is not enabled")
+	ErrMFAAlreadyEnabled = errors.New(409, "mfa is already enabled")
+	ErrMFARequired       = errors.New(403, "mfa is required for your role")
+	ErrInvalidMFAToken   = errors.New(401, "invalid or expired mfa token")
+)
+
+// MFAChallenge is returned by a login instead of tokens when a second
+// factor is needed. The mfa_token is exchanged at /auth/mfa/verify or, when
+// enrollment is required, authorizes /auth/mfa/enroll and /auth/mfa/enable.
+type MFAChallenge struct {
+	MFARequired        bool      `json:"mfa_required"`
+	EnrollmentRequired bool      `json:"mfa_enrollment_required,omitempty"`
+	MFAToken           string    `json:"mfa_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_code"` // PNG data URI of URI
+}
+
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAEnableResponse struct {
+	RecoveryCodes []string            `json:"recovery_codes"`
+	Auth          *users.AuthResponse `json:"auth,omitempty"` // set when enabling completed a login
+}
+
+// MFAService manages TOTP enrollment and verifies second factors.
+type MFAService struct {
+	repo     *mfa.Repository
+	settings *settings.Repository
+	box      *secretbox.Box
+	issuer   string
+}
+
+func NewMFAService(repo *mfa.Repository, settingsRepo *settings.Repository, cfg *config.MFAConfig) *MFAService {
+	return &MFAService{
+		repo:     repo,
+		settings: settingsRepo,
+		box:      secretbox.New(cfg.EncryptionKey, mfaSecretPurpose),
+		issuer:   cfg.Issuer,
+	}
+}
+
+// Enroll generates a new secret for user. It takes effect once Enable is
+// called with a code from it.
+func (s *MFAService) Enroll(user *users.User) (*MFAEnrollment, error) {
+	existing, err := s.repo.GetEnrollment(user.ID)
+	if err != nil && err != errors.ErrNotFound {
+		return nil, err
+	}
+	if existing != nil && existing.Enabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret := mfa.GenerateSecret()
+	if err := s.repo.SavePendingEnrollment(user.ID, s.box.Seal(secret)); err != nil {
+		return nil, err
+	}
+
+	uri := mfa.KeyURI(s.issuer, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, -qrCodeScale)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to render qr code", err)
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Enable confirms a pending enrollment with a code and returns fresh
+// recovery codes, which are shown only this once.
+func (s *MFAService) Enable(userID uuid.UUID, code string) ([]string, error) {
+	e, err := s.repo.GetEnrollment(userID)
+	if err == errors.ErrNotFound {
+		return nil, errors.New(400, "start enrollment first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Enabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.box.Open(e.SecretEncrypted)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to read mfa secret", err)
+	}
+	step, ok := mfa.Validate(secret, code, time.Now(), e.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := mfa.GenerateRecoveryCodes(recoveryCodeCount)
+	if err := s.repo.Enable(userID, step, hashRecoveryCodes(codes)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes MFA after checking a current code. Users whose role
+// requires MFA cannot turn it off.
+func (s *MFAService) Disable(user *users.User, code string) error {
+	required, err := s.required(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+	if err := s.Verify(user.ID, code, ""); err != nil {
+		return err
+	}
+	return s.repo.Delete(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code.
+func (s *MFAService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Verify(userID, code, ""); err != nil {
+		return nil, err
+	}
+	codes := mfa.GenerateRecoveryCodes(recoveryCodeCount)
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashRecoveryCodes(codes)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *MFAService) Status(user *users.User) (*MFAStatus, error) {
+	status := &MFAStatus{}
+	var err error
+	if status.Required, err = s.required(user.Role); err != nil {
+		return nil, err
+	}
+	if status.Enabled, err = s.enabled(user.ID); err != nil {
+		return nil, err
+	}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.repo.CountUnusedRecoveryCodes(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Verify checks a TOTP code or, if code is empty, a recovery code. Repeated
+// failures lock verification for a while.
+func (s *MFAService) Verify(userID uuid.UUID, code, recoveryCode string) error {
+	e, err := s.repo.GetEnrollment(userID)
+	if err == errors.ErrNotFound {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !e.Enabled() {
+		return ErrMFANotEnabled
+	}
+	if e.LockedUntil != nil && time.Now().Before(*e.LockedUntil) {
+		return ErrMFALocked
+	}
+
+	var ok bool
+	if code != "" {
+		secret, err := s.box.Open(e.SecretEncrypted)
+		if err != nil {
+			return errors.Wrap(500, "failed to read mfa secret", err)
+		}
+		if step, valid := mfa.Validate(secret, code, time.Now(), e.LastUsedStep); valid {
+			if ok, err = s.repo.RecordSuccess(userID, step); err != nil {
+				return err
+			}
+		}
+	} else if recoveryCode != "" {
+		hash := token.Hash(mfa.NormalizeRecoveryCode(recoveryCode))
+		if ok, err = s.repo.UseRecoveryCode(userID, hash); err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		if err := s.repo.RecordFailure(userID, mfaMaxAttempts, mfaLockout); err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *MFAService) enabled(userID uuid.UUID) (bool, error) {
+	e, err := s.repo.GetEnrollment(userID)
+	if err == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return e.Enabled(), nil
+}
+
+// required reports whether role must use MFA. Today only admins can be
+// required to, through the admin settings.
+func (s *MFAService) required(role string) (bool, error) {
+	if role != rbac.RoleAdmin {
+		return false, nil
+	}
+	return s.settings.MFARequiredForAdmins()
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = token.Hash(mfa.NormalizeRecoveryCode(code))
+	}
+	return hashes
+}
+
+// completeLogin finishes a login whose first factor succeeded, either by
+// issuing tokens or by returning an MFA challenge.
+func (s *AuthService) completeLogin(user *users.User, client ClientInfo) (*users.AuthResponse, *MFAChallenge, error) {
+	if user.SuspendedAt != nil {
+		return nil, nil, ErrAccountSuspended
+	}
+
+	enabled, err := s.mfa.enabled(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	required, err := s.mfa.required(user.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	purpose := ""
+	switch {
+	case enabled:
+		purpose = PurposeMFA
+	case required:
+		purpose = PurposeMFAEnroll
+	default:
+		resp, err := s.startSession(user, client)
+		return resp, nil, err
+	}
+
+	mfaToken, expiresAt, err := s.jwt.GeneratePurposeToken(user.ID, user.Email, user.Role, purpose, mfaTokenTTL)
+	if err != nil {
+		return nil, nil, errors.Wrap(500, "failed to generate token", err)
+	}
+	return nil, &MFAChallenge{
+		MFARequired:        true,
+		EnrollmentRequired: purpose == PurposeMFAEnroll,
+		MFAToken:           mfaToken,
+		ExpiresAt:          expiresAt,
+	}, nil
+}
+
+// VerifyMFA completes a login with the second factor.
+func (s *AuthService) VerifyMFA(req *MFAVerifyRequest, client ClientInfo) (*users.AuthResponse, error) {
+	claims, err := s.authenticatePurpose(req.MFAToken, PurposeMFA)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.Verify(claims.UserID, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+
+	return s.finishMFALogin(claims, client)
+}
+
+// AuthenticateMFAEnrollment accepts an access token or, for users who must
+// enroll before they can sign in, an enrollment token.
+func (s *AuthService) AuthenticateMFAEnrollment(tokenString string) (*Claims, error) {
+	if claims, err := s.authenticatePurpose(tokenString, PurposeMFAEnroll); err == nil {
+		return claims, nil
+	}
+	return s.Authenticate(tokenString)
+}
+
+// EnableMFA confirms enrollment. When the request was made with an
+// enrollment token, the pending login is completed as well.
+func (s *AuthService) EnableMFA(claims *Claims, code string, client ClientInfo) (*MFAEnableResponse, error) {
+	codes, err := s.mfa.Enable(claims.UserID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &MFAEnableResponse{RecoveryCodes: codes}
+	if claims.Purpose == PurposeMFAEnroll {
+		if resp.Auth, err = s.finishMFALogin(claims, client); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *AuthService) finishMFALogin(claims *Claims, client ClientInfo) (*users.AuthResponse, error) {
+	// The restricted token is single-use.
+	if err := s.revokeAccessToken(claims); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	return s.startSession(user, client)
+}
+
+func (s *AuthService) authenticatePurpose(tokenString, purpose string) (*Claims, error) {
+	claims, err := s.jwt.ValidateToken(tokenString)
+	if err != nil || claims.Purpose != purpose {
+		return nil, ErrInvalidMFAToken
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	revoked, err := s.tokens.IsAccessTokenRevoked(jti)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/oidc"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+// OIDCStateTTL bounds how long a user may take at the identity provider.
+const OIDCStateTTL = 10 * time.Minute
+
+var ErrInvalidOIDCState = errors.New(401, "invalid or expired login state")
+
+// OIDCLoginState is the server-side half of an authorization request. The
+// browser holds the state (in the redirect) and the binding (in a cookie);
+// both must come back to complete the login, which stops an attacker from
+// planting their own authorization response on a victim's browser.
+type OIDCLoginState struct {
+	StateHash    string
+	BindingHash  string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// OIDCLogin is returned when a login starts: the provider URL to redirect
+// to and the binding value to set as a cookie.
+type OIDCLogin struct {
+	URL     string
+	Binding string
+}
+
+func (r *TokenRepository) CreateOIDCLoginState(ls *OIDCLoginState) error {
+	// Abandoned logins are never consumed; clear them out as new ones start.
+	if _, err := r.db.Exec(`DELETE FROM oidc_login_states WHERE expires_at < $1`, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to prune login states", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, binding_hash, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, ls.StateHash, ls.BindingHash, ls.Nonce, ls.CodeVerifier, ls.ExpiresAt, ls.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create login state", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState deletes and returns a login state, so each
+// authorization response can be redeemed once.
+func (r *TokenRepository) ConsumeOIDCLoginState(stateHash string) (*OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states WHERE state_hash = $1
+		RETURNING state_hash, binding_hash, nonce, code_verifier, expires_at, created_at
+	`
+	ls := &OIDCLoginState{}
+	err := r.db.QueryRow(query, stateHash).Scan(
+		&ls.StateHash, &ls.BindingHash, &ls.Nonce, &ls.CodeVerifier, &ls.ExpiresAt, &ls.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to consume login state", err)
+	}
+	return ls, nil
+}
+
+// OIDCService signs users in through an OpenID provider and provisions
+// their accounts on first login.
+type OIDCService struct {
+	provider *oidc.Provider
+	auth     *AuthService
+}
+
+func NewOIDCService(provider *oidc.Provider, authService *AuthService) *OIDCService {
+	return &OIDCService{provider: provider, auth: authService}
+}
+
+// Start begins an authorization code flow with PKCE.
+func (s *OIDCService) Start(ctx context.Context) (*OIDCLogin, error) {
+	state := token.New(32)
+	binding := token.New(32)
+	nonce := token.New(32)
+	verifier := token.New(48)
+
+	url, err := s.provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return nil, errors.Wrap(502, "identity provider unavailable", err)
+	}
+
+	ls := &OIDCLoginState{
+		StateHash:    token.Hash(state),
+		BindingHash:  token.Hash(binding),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.auth.tokens.CreateOIDCLoginState(ls); err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{URL: url, Binding: binding}, nil
+}
+
+// Complete redeems the authorization response and issues our own tokens
+// for the matching user, or an MFA challenge if the user has a second
+// factor.
+func (s *OIDCService) Complete(ctx context.Context, code, state, binding string, client ClientInfo) (*users.AuthResponse, *MFAChallenge, error) {
+	ls, err := s.auth.tokens.ConsumeOIDCLoginState(token.Hash(state))
+	if err == errors.ErrNotFound {
+		return nil, nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(ls.ExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(ls.BindingHash), []byte(token.Hash(binding))) != 1 {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := s.provider.Exchange(ctx, code, ls.CodeVerifier)
+	if err != nil {
+		return nil, nil, errors.Wrap(502, "identity provider rejected the authorization code", err)
+	}
+
+	claims, err := s.provider.VerifyIDToken(ctx, rawIDToken, ls.Nonce)
+	if err != nil {
+		return nil, nil, errors.Wrap(401, "invalid id token", err)
+	}
+
+	user, err := s.provisionUser(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.auth.completeLogin(user, client)
+}
+
+// provisionUser finds the user linked to the token's subject. On first
+// login the identity is linked to an existing account with the same,
+// provider-verified email, or a new account is created. Accounts created
+// here have no password and can only sign in through the provider.
+func (s *OIDCService) provisionUser(claims *oidc.IDTokenClaims) (*users.User, error) {
+	issuer := s.provider.Issuer()
+
+	user, err := s.auth.userRepo.GetByIdentity(issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if err != errors.ErrNotFound {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New(401, "identity provider did not supply an email")
+	}
+
+	user, err = s.auth.userRepo.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Linking on an unverified email would let anyone who can set
+		// that email at the provider take over the account.
+		if !claims.EmailVerified {
+			return nil, errors.New(409, "an account with this email already exists")
+		}
+	case err == errors.ErrNotFound:
+		user = &users.User{
+			ID:           uuid.New(),
+			Email:        claims.Email,
+			Role:         rbac.RoleUser,
+			StorageQuota: 1073741824,
+			StorageUsed:  0,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		// Only a provider-verified email can earn the bootstrap admin
+		// role; otherwise it waits for the user to verify it here.
+		if claims.EmailVerified {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			err = s.auth.userRepo.CreateVerified(user, s.auth.bootstrapAdminEmail)
+		} else {
+			err = s.auth.userRepo.Create(user)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	identity := &users.Identity{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	}
+	if err := s.auth.userRepo.CreateIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
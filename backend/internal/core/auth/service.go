@@ -1,41 +1,67 @@
 package auth
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
 	"github.com/samridh-111/balkan_task/internal/core/users"
 	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New(401, "invalid refresh token")
+	ErrTokenRevoked        = errors.New(401, "token revoked")
+	ErrInvalidAPIKey       = errors.New(401, "invalid api key")
+	ErrEmailNotVerified    = errors.New(403, "email address not verified")
+	ErrAccountSuspended    = errors.New(403, "account suspended")
 )
 
 type AuthService struct {
-	userRepo *users.Repository
-	jwt      *Service
+	userRepo             *users.Repository
+	tokens               *TokenRepository
+	jwt                  *Service
+	mfa                  *MFAService
+	throttle             *LoginThrottle
+	bootstrapAdminEmail  string
+	requireVerifiedEmail bool
 }
 
-func NewAuthService(userRepo *users.Repository, jwtService *Service) *AuthService {
+func NewAuthService(userRepo *users.Repository, tokenRepo *TokenRepository, jwtService *Service, mfaService *MFAService, throttle *LoginThrottle, cfg *config.AuthConfig) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		jwt:      jwtService,
+		userRepo:             userRepo,
+		tokens:               tokenRepo,
+		jwt:                  jwtService,
+		mfa:                  mfaService,
+		throttle:             throttle,
+		bootstrapAdminEmail:  strings.ToLower(strings.TrimSpace(cfg.BootstrapAdminEmail)),
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
 	}
 }
 
-func (s *AuthService) Register(req *users.CreateUserRequest) (*users.AuthResponse, error) {
+// Register creates an account and signs the user in. When verified emails
+// are required no session is started and the returned response is nil;
+// the user signs in once they have followed the verification link.
+func (s *AuthService) Register(req *users.CreateUserRequest, client ClientInfo) (*users.User, *users.AuthResponse, error) {
 	existing, _ := s.userRepo.GetByEmail(req.Email)
 	if existing != nil {
-		return nil, errors.New(409, "user already exists")
+		return nil, nil, errors.New(409, "user already exists")
 	}
 
 	passwordHash, err := HashPassword(req.Password)
 	if err != nil {
-		return nil, errors.Wrap(500, "failed to hash password", err)
+		return nil, nil, errors.Wrap(500, "failed to hash password", err)
 	}
 
 	user := &users.User{
 		ID:           uuid.New(),
 		Email:        req.Email,
 		PasswordHash: passwordHash,
-		Role:         "admin",
+		Role:         rbac.RoleUser,
 		StorageQuota: 1073741824,
 		StorageUsed:  0,
 		CreatedAt:    time.Now(),
@@ -43,38 +69,313 @@ func (s *AuthService) Register(req *users.CreateUserRequest) (*users.AuthRespons
 	}
 
 	if err := s.userRepo.Create(user); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if s.requireVerifiedEmail {
+		return user, nil, nil
 	}
 
-	token, err := s.jwt.GenerateToken(user.ID, user.Email, user.Role)
+	resp, err := s.startSession(user, client)
 	if err != nil {
-		return nil, errors.Wrap(500, "failed to generate token", err)
+		return nil, nil, err
 	}
+	return user, resp, nil
+}
 
-	return &users.AuthResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+// Login checks the password. Users with MFA get a challenge instead of
+// tokens. Repeated failures for an account or from an IP are throttled,
+// and every attempt is recorded.
+func (s *AuthService) Login(req *users.LoginRequest, client ClientInfo) (*users.AuthResponse, *MFAChallenge, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var user *users.User
+	err := s.throttle.Attempt(email, client, func() (*uuid.UUID, string, error) {
+		// Unknown emails still pay for a bcrypt comparison so the response
+		// time does not reveal which accounts exist.
+		found, err := s.userRepo.GetByEmail(req.Email)
+		if err != nil && err != errors.ErrNotFound {
+			return nil, "", err
+		}
+		if !checkPassword(found, req.Password) {
+			if found == nil {
+				return nil, AttemptInvalidCredentials, errors.ErrUnauthorized
+			}
+			return &found.ID, AttemptInvalidCredentials, errors.ErrUnauthorized
+		}
+
+		if s.requireVerifiedEmail && found.EmailVerifiedAt == nil {
+			return &found.ID, AttemptEmailNotVerified, ErrEmailNotVerified
+		}
+		if found.SuspendedAt != nil {
+			return &found.ID, AttemptAccountSuspended, ErrAccountSuspended
+		}
+
+		user = found
+		return &found.ID, AttemptSuccess, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.completeLogin(user, client)
 }
 
-func (s *AuthService) Login(req *users.LoginRequest) (*users.AuthResponse, error) {
-	user, err := s.userRepo.GetByEmail(req.Email)
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkPassword compares password against the user's hash, or against a
+// throwaway hash when there is no user or the account has no password, so
+// every path costs one bcrypt comparison.
+func checkPassword(user *users.User, password string) bool {
+	if user != nil && user.PasswordHash != "" {
+		return CheckPasswordHash(password, user.PasswordHash)
+	}
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("not-a-real-password")
+	})
+	CheckPasswordHash(password, dummyHash)
+	return false
+}
+
+// JWKS returns the public token verification keys; see Service.JWKS.
+func (s *AuthService) JWKS() (*JWKSet, bool) {
+	return s.jwt.JWKS()
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a token that was already exchanged revokes the
+// whole family, cutting off both the thief and the legitimate client.
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*users.AuthResponse, error) {
+	rt, err := s.tokens.GetRefreshTokenByHash(token.Hash(refreshToken))
+	if err == errors.ErrNotFound {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	consumed, err := s.tokens.MarkRefreshTokenUsed(rt.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		if err := s.tokens.RevokeFamily(rt.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(rt.UserID)
 	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	resp, err := s.issueTokens(user, rt.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokens.RefreshSession(rt.FamilyID, client.IP, client.UserAgent, time.Now().Add(s.jwt.RefreshExpiration())); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Logout revokes the access token presented with the request and the
+// refresh token family of its session.
+func (s *AuthService) Logout(claims *Claims) error {
+	if err := s.revokeAccessToken(claims); err != nil {
+		return err
+	}
+	if claims.SessionID != uuid.Nil {
+		return s.tokens.RevokeFamily(claims.SessionID)
+	}
+	return nil
+}
+
+// Authenticate validates an access token and rejects tokens that were
+// revoked, or whose session was ended, before their expiry.
+func (s *AuthService) Authenticate(tokenString string) (*Claims, error) {
+	if strings.HasPrefix(tokenString, APIKeyPrefix) {
+		return s.authenticateAPIKey(tokenString)
+	}
+
+	claims, err := s.jwt.ValidateToken(tokenString)
+	if err != nil || claims.Purpose != "" {
 		return nil, errors.ErrUnauthorized
 	}
 
-	if !CheckPasswordHash(req.Password, user.PasswordHash) {
+	suspended, err := s.userRepo.IsSuspended(claims.UserID)
+	if err == errors.ErrNotFound {
 		return nil, errors.ErrUnauthorized
 	}
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, ErrAccountSuspended
+	}
+
+	// Tokens issued before revocation support carry no ID and simply
+	// expire.
+	if jti, err := uuid.Parse(claims.ID); err == nil {
+		revoked, err := s.tokens.IsAccessTokenRevoked(jti)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	if claims.Act != nil {
+		if err := s.checkActor(claims.Act); err != nil {
+			return nil, err
+		}
+	}
+
+	if claims.SessionID != uuid.Nil {
+		revoked, err := s.tokens.IsSessionRevoked(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+		if err := s.tokens.TouchSession(claims.SessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// authenticateAPIKey resolves an API key to claims for its owner. The role
+// is read fresh from the user so a demotion applies to existing keys.
+func (s *AuthService) authenticateAPIKey(key string) (*Claims, error) {
+	apiKey, err := s.tokens.GetAPIKeyByHash(token.Hash(key))
+	if err == errors.ErrNotFound {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, ErrTokenRevoked
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(apiKey.UserID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+
+	if err := s.tokens.TouchAPIKey(apiKey.ID); err != nil {
+		return nil, err
+	}
 
-	token, err := s.jwt.GenerateToken(user.ID, user.Email, user.Role)
+	return &Claims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+// CreateAPIKey issues a new API key for a user. Scopes must be permissions
+// the user's role grants; the key is returned once and only its hash kept.
+func (s *AuthService) CreateAPIKey(user *users.User, req *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !rbac.HasPermission(user.Role, rbac.Permission(scope)) {
+			return nil, errors.New(400, "invalid scope: "+scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New(400, "expires_at must be in the future")
+	}
+
+	key := APIKeyPrefix + token.New(32)
+	apiKey := &APIKey{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    key[:len(APIKeyPrefix)+8],
+		KeyHash:   token.Hash(key),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.tokens.CreateAPIKey(apiKey); err != nil {
+		return nil, err
+	}
+
+	return &CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+func (s *AuthService) ListAPIKeys(userID uuid.UUID) ([]*APIKey, error) {
+	return s.tokens.ListAPIKeys(userID)
+}
+
+func (s *AuthService) RevokeAPIKey(id, userID uuid.UUID) error {
+	return s.tokens.RevokeAPIKey(id, userID)
+}
+
+func (s *AuthService) revokeAccessToken(claims *Claims) error {
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.tokens.RevokeAccessToken(jti, claims.ExpiresAt.Time)
+}
+
+// issueTokens creates an access token and a refresh token for a session.
+// familyID identifies the session across refresh token rotations.
+func (s *AuthService) issueTokens(user *users.User, familyID uuid.UUID) (*users.AuthResponse, error) {
+	accessToken, expiresAt, err := s.jwt.GenerateToken(user.ID, user.Email, user.Role, familyID)
 	if err != nil {
 		return nil, errors.Wrap(500, "failed to generate token", err)
 	}
 
+	refreshToken := token.New(32)
+	rt := &RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: token.Hash(refreshToken),
+		ExpiresAt: time.Now().Add(s.jwt.RefreshExpiration()),
+		CreatedAt: time.Now(),
+	}
+	if err := s.tokens.CreateRefreshToken(rt); err != nil {
+		return nil, err
+	}
+
 	return &users.AuthResponse{
-		Token: token,
-		User:  *user,
+		Token:        accessToken,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         *user,
 	}, nil
 }
-
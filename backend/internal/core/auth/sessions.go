@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+const (
+	// Last-seen times are written at most this often per session.
+	sessionTouchInterval = time.Minute
+
+	// Ended sessions are kept this long so they can still be audited.
+	sessionRetention = 30 * 24 * time.Hour
+)
+
+var ErrSessionNotFound = errors.New(404, "session not found")
+
+// Session is one login on one device. Its ID is the refresh token family,
+// so ending a session revokes its refresh tokens and, through the per
+// request check in Authenticate, its access tokens.
+type Session struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	DeviceLabel string    `json:"device_label"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"`
+}
+
+func (r *TokenRepository) CreateSession(s *Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, ip_address, user_agent, device_label, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.Exec(query, s.ID, s.UserID, s.IPAddress, s.UserAgent, s.DeviceLabel, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create session", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1`, time.Now().Add(-sessionRetention)); err != nil {
+		return errors.Wrap(500, "failed to prune sessions", err)
+	}
+	return nil
+}
+
+// RefreshSession records a token refresh: the client may have moved, and
+// the session now lasts as long as the new refresh token.
+func (r *TokenRepository) RefreshSession(id uuid.UUID, ip, userAgent string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET ip_address = $2, user_agent = $3, device_label = $4, last_seen_at = $5, expires_at = $6
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(query, id, ip, userAgent, deviceLabel(userAgent), time.Now(), expiresAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to update session", err)
+	}
+	return nil
+}
+
+// TouchSession updates the last-seen time, coalesced to one write per
+// sessionTouchInterval.
+func (r *TokenRepository) TouchSession(id uuid.UUID) error {
+	now := time.Now()
+	query := `UPDATE sessions SET last_seen_at = $1 WHERE id = $2 AND last_seen_at < $3`
+	if _, err := r.db.Exec(query, now, id, now.Add(-sessionTouchInterval)); err != nil {
+		return errors.Wrap(500, "failed to touch session", err)
+	}
+	return nil
+}
+
+// ListSessions returns the user's sessions that have not ended, most
+// recently used first.
+func (r *TokenRepository) ListSessions(userID uuid.UUID) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, ip_address, user_agent, device_label, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := r.db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		s := &Session{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.DeviceLabel,
+			&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan session", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions. It returns
+// ErrSessionNotFound if the session is not the user's or already ended.
+func (r *TokenRepository) RevokeSession(id, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		return errors.Wrap(500, "failed to revoke session", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return r.RevokeFamily(id)
+}
+
+// startSession begins a new session for a completed login.
+func (s *AuthService) startSession(user *users.User, client ClientInfo) (*users.AuthResponse, error) {
+	now := time.Now()
+	session := &Session{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		IPAddress:   client.IP,
+		UserAgent:   client.UserAgent,
+		DeviceLabel: deviceLabel(client.UserAgent),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(s.jwt.RefreshExpiration()),
+	}
+	if err := s.tokens.CreateSession(session); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.RecordLogin(user.ID, now); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user, session.ID)
+}
+
+// ListSessions returns the user's active sessions, flagging the one the
+// request was made with.
+func (s *AuthService) ListSessions(claims *Claims) ([]*Session, error) {
+	sessions, err := s.tokens.ListSessions(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == claims.SessionID
+	}
+	return sessions, nil
+}
+
+// ListUserSessions returns a user's active sessions for an admin.
+func (s *AuthService) ListUserSessions(userID uuid.UUID) ([]*Session, error) {
+	return s.tokens.ListSessions(userID)
+}
+
+func (s *AuthService) RevokeSession(claims *Claims, id uuid.UUID) error {
+	return s.tokens.RevokeSession(id, claims.UserID)
+}
+
+// RevokeOtherSessions signs the user out everywhere but here.
+func (s *AuthService) RevokeOtherSessions(claims *Claims) error {
+	return s.tokens.RevokeUserSessions(claims.UserID, claims.SessionID)
+}
+
+// RevokeAllSessions signs a user out of every session.
+func (s *AuthService) RevokeAllSessions(userID uuid.UUID) error {
+	return s.tokens.RevokeUserSessions(userID, uuid.Nil)
+}
+
+// deviceLabel turns a User-Agent into something a person recognizes, such
+// as "Firefox on Windows". It only has to be good enough to tell a user's
+// own devices apart.
+func deviceLabel(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			platform = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	if name, _, _ := strings.Cut(userAgent, "/"); name != "" && len(name) <= 40 {
+		return name
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// RefreshToken is one link in a rotation chain. Every refresh marks the
+// presented token used and issues a successor in the same family; presenting
+// a used token again means it was stolen, and the whole family is revoked.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type TokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+func (r *TokenRepository) CreateRefreshToken(rt *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, rt.ID, rt.UserID, rt.FamilyID, rt.TokenHash, rt.ExpiresAt, rt.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create refresh token", err)
+	}
+	return nil
+}
+
+func (r *TokenRepository) GetRefreshTokenByHash(hash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	rt := &RefreshToken{}
+	var usedAt, revokedAt sql.NullTime
+	err := r.db.QueryRow(query, hash).Scan(
+		&rt.ID, &rt.UserID, &rt.FamilyID, &rt.TokenHash, &rt.ExpiresAt,
+		&usedAt, &revokedAt, &rt.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get refresh token", err)
+	}
+	if usedAt.Valid {
+		rt.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		rt.RevokedAt = &revokedAt.Time
+	}
+	return rt, nil
+}
+
+// MarkRefreshTokenUsed consumes a refresh token. It returns false if the
+// token was already used or revoked, which happens when two requests race
+// to rotate the same token.
+func (r *TokenRepository) MarkRefreshTokenUsed(id uuid.UUID) (bool, error) {
+	query := `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return false, errors.Wrap(500, "failed to use refresh token", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(500, "failed to get rows affected", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// RevokeFamily revokes every refresh token descended from the same login,
+// ending its session.
+func (r *TokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	now := time.Now()
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	if _, err := r.db.Exec(query, now, familyID); err != nil {
+		return errors.Wrap(500, "failed to revoke refresh tokens", err)
+	}
+	query = `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	if _, err := r.db.Exec(query, now, familyID); err != nil {
+		return errors.Wrap(500, "failed to revoke session", err)
+	}
+	return nil
+}
+
+// RevokeAccessToken adds an access token's ID to the denylist until the
+// token would have expired anyway. Expired entries are pruned on the way.
+func (r *TokenRepository) RevokeAccessToken(jti uuid.UUID, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expires_at, revoked_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	if _, err := r.db.Exec(query, jti, expiresAt, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to revoke access token", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < $1`, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to prune revoked tokens", err)
+	}
+	return nil
+}
+
+func (r *TokenRepository) IsAccessTokenRevoked(jti uuid.UUID) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	if err := r.db.QueryRow(query, jti).Scan(&revoked); err != nil {
+		return false, errors.Wrap(500, "failed to check token revocation", err)
+	}
+	return revoked, nil
+}
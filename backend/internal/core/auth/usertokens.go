@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Purposes of single-use tokens mailed to users.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+func (r *TokenRepository) CreateUserToken(userID uuid.UUID, purpose, hash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := r.db.Exec(query, uuid.New(), userID, purpose, hash, expiresAt, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to create token", err)
+	}
+	return nil
+}
+
+// ConsumeUserToken marks a valid, unused token for purpose as used and
+// returns its user. Expired, used and unknown tokens are all ErrNotFound.
+func (r *TokenRepository) ConsumeUserToken(hash, purpose string) (uuid.UUID, error) {
+	query := `
+		UPDATE user_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id
+	`
+	var userID uuid.UUID
+	err := r.db.QueryRow(query, time.Now(), hash, purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, errors.Wrap(500, "failed to consume token", err)
+	}
+	return userID, nil
+}
+
+// InvalidateUserTokens voids every outstanding token of purpose for a user.
+func (r *TokenRepository) InvalidateUserTokens(userID uuid.UUID, purpose string) error {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	if _, err := r.db.Exec(query, time.Now(), userID, purpose); err != nil {
+		return errors.Wrap(500, "failed to invalidate tokens", err)
+	}
+	return nil
+}
+
+// UserTokenIssuedSince reports whether a token of purpose was issued to the
+// user after since; used to throttle outgoing mail.
+func (r *TokenRepository) UserTokenIssuedSince(userID uuid.UUID, purpose string, since time.Time) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > $3)`
+	if err := r.db.QueryRow(query, userID, purpose, since).Scan(&exists); err != nil {
+		return false, errors.Wrap(500, "failed to check tokens", err)
+	}
+	return exists, nil
+}
+
+// RevokeUserSessions revokes every refresh token family of a user except
+// keep, which may be uuid.Nil to revoke all of them.
+func (r *TokenRepository) RevokeUserSessions(userID, keep uuid.UUID) error {
+	now := time.Now()
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND family_id <> $3 AND revoked_at IS NULL`
+	if _, err := r.db.Exec(query, now, userID, keep); err != nil {
+		return errors.Wrap(500, "failed to revoke sessions", err)
+	}
+	query = `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL`
+	if _, err := r.db.Exec(query, now, userID, keep); err != nil {
+		return errors.Wrap(500, "failed to revoke sessions", err)
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether the refresh token family an access token
+// was issued for has been revoked, which ends the session immediately.
+func (r *TokenRepository) IsSessionRevoked(familyID uuid.UUID) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = $1 AND revoked_at IS NOT NULL)`
+	if err := r.db.QueryRow(query, familyID).Scan(&revoked); err != nil {
+		return false, errors.Wrap(500, "failed to check session revocation", err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,105 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
+)
+
+// AdminFileQuery filters the cross-user file listing. Search matches the
+// file name or the owner's email; Held keeps only files under a legal hold
+// or retention lock.
+type AdminFileQuery struct {
+	Search   string     `form:"search"`
+	UserID   *uuid.UUID `form:"-"`
+	MimeType string     `form:"mime_type"`
+	Held     bool       `form:"held"`
+	Sort     string     `form:"sort"`
+	Order    string     `form:"order"`
+	Page     int        `form:"page"`
+	PageSize int        `form:"page_size"`
+}
+
+// AdminFile is a file as listed to admins, with its owner and download
+// count.
+type AdminFile struct {
+	File
+	UserEmail string `json:"user_email"`
+	Downloads int    `json:"downloads"`
+}
+
+var adminFileSorts = map[string]string{
+	"name":       "f.name",
+	"size":       "fc.size",
+	"created_at": "f.created_at",
+	"downloads":  "downloads",
+}
+
+// AdminListFiles searches files across all users. It returns one page and
+// the total number of matches.
+func (r *Repository) AdminListFiles(q *AdminFileQuery) ([]*AdminFile, int, error) {
+	orderBy, err := listing.OrderBy(adminFileSorts, q.Sort, q.Order, "created_at", "f.id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.Search != "" {
+		args = append(args, "%"+q.Search+"%")
+		where = append(where, fmt.Sprintf("(f.name ILIKE $%[1]d OR u.email ILIKE $%[1]d)", len(args)))
+	}
+	if q.UserID != nil {
+		args = append(args, *q.UserID)
+		where = append(where, fmt.Sprintf("f.user_id = $%d", len(args)))
+	}
+	if q.MimeType != "" {
+		args = append(args, q.MimeType)
+		where = append(where, fmt.Sprintf("f.mime_type = $%d", len(args)))
+	}
+	if q.Held {
+		args = append(args, time.Now())
+		where = append(where, fmt.Sprintf(fileHeld, len(args)))
+	}
+	filter := strings.Join(where, " AND ")
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM files f JOIN users u ON u.id = f.user_id WHERE ` + filter
+	if err := r.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(500, "failed to count files", err)
+	}
+
+	args = append(args, q.PageSize, (q.Page-1)*q.PageSize)
+	listQuery := fmt.Sprintf(`
+		SELECT `+fileColumns+`, u.email,
+		       (SELECT COUNT(*) FROM download_logs d WHERE d.file_id = f.id) AS downloads
+		FROM files f
+		JOIN file_contents fc ON f.file_content_id = fc.id
+		JOIN users u ON u.id = f.user_id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, filter, orderBy, len(args)-1, len(args))
+
+	rows, err := r.db.Query(listQuery, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(500, "failed to list files", err)
+	}
+	defer rows.Close()
+
+	list := []*AdminFile{}
+	for rows.Next() {
+		f := &AdminFile{}
+		file, err := scanFile(rows, &f.UserEmail, &f.Downloads)
+		if err != nil {
+			return nil, 0, errors.Wrap(500, "failed to scan file", err)
+		}
+		f.File = *file
+		list = append(list, f)
+	}
+	return list, total, nil
+}
@@ -0,0 +1,357 @@
+package files
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// ShareView records one visit to a share link's landing endpoint.
+type ShareView struct {
+	ShareID   uuid.UUID
+	FileID    uuid.UUID // uuid.Nil when a folder or collection listing is viewed
+	UserID    uuid.UUID // uuid.Nil for anonymous visitors
+	IPAddress string
+	UserAgent string
+	Referrer  string
+}
+
+// ShareSummary is a share owned by the caller with its lifetime totals.
+type ShareSummary struct {
+	FileShare
+	TargetName string `json:"target_name"`
+	Views      int    `json:"views"`
+	Downloads  int    `json:"downloads"`
+}
+
+// AccessQuery selects the access records to aggregate. Exactly one of
+// FileID and ShareID should be set.
+type AccessQuery struct {
+	FileID  *uuid.UUID
+	ShareID *uuid.UUID
+	From    time.Time
+	To      time.Time
+}
+
+type DailyAccess struct {
+	Day       string `json:"day"`
+	Views     int    `json:"views"`
+	Downloads int    `json:"downloads"`
+}
+
+type RankedValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type AccessStats struct {
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Views          int           `json:"views"`
+	Downloads      int           `json:"downloads"`
+	UniqueVisitors int           `json:"unique_visitors"`
+	Daily          []DailyAccess `json:"daily"`
+	TopReferrers   []RankedValue `json:"top_referrers"`
+	TopUserAgents  []RankedValue `json:"top_user_agents"`
+}
+
+// AccessEntry is a single view or download as shown to the share's owner.
+type AccessEntry struct {
+	Event      string    `json:"event"`
+	ShareID    uuid.UUID `json:"share_id"`
+	UserEmail  string    `json:"user_email,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Referrer   string    `json:"referrer,omitempty"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// hashIP returns the value used to count unique visitors without comparing
+// raw addresses. It is keyed so that it cannot be reversed by hashing every
+// possible address.
+func (r *Repository) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.ipKey)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashMissingIPs fills in the visitor hash of rows whose IP has not been
+// anonymized yet but has no hash, such as rows whose unkeyed hashes from
+// older versions were cleared by migration 026. It returns how many rows
+// were hashed.
+func (r *Repository) HashMissingIPs() (int, error) {
+	total := 0
+	for _, table := range []string{"download_logs", "share_views"} {
+		for {
+			n, err := r.hashMissingBatch(table)
+			if err != nil {
+				return total, err
+			}
+			total += n
+			if n < anonymizeBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (r *Repository) hashMissingBatch(table string) (int, error) {
+	query := `SELECT id, ip_address FROM ` + table + `
+		WHERE ip_hash IS NULL AND ip_anonymized_at IS NULL AND ip_address <> ''
+		LIMIT $1`
+	rows, err := r.db.Query(query, anonymizeBatch)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to list IPs to hash", err)
+	}
+	type row struct {
+		id uuid.UUID
+		ip string
+	}
+	var batch []row
+	for rows.Next() {
+		var rw row
+		if err := rows.Scan(&rw.id, &rw.ip); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(500, "failed to scan IP to hash", err)
+		}
+		batch = append(batch, rw)
+	}
+	rows.Close()
+
+	for _, rw := range batch {
+		query := `UPDATE ` + table + ` SET ip_hash = $1 WHERE id = $2 AND ip_anonymized_at IS NULL`
+		if _, err := r.db.Exec(query, r.hashIP(rw.ip), rw.id); err != nil {
+			return 0, errors.Wrap(500, "failed to hash IP", err)
+		}
+	}
+	return len(batch), nil
+}
+
+func (r *Repository) LogShareView(view *ShareView) error {
+	query := `
+		INSERT INTO share_views (id, share_id, file_id, user_id, ip_address, ip_hash, user_agent, referrer, viewed_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.Exec(query, view.ShareID, nullableUUID(view.FileID), nullableUUID(view.UserID), view.IPAddress,
+		r.hashIP(view.IPAddress), view.UserAgent, view.Referrer, time.Now())
+	if err != nil {
+		return errors.Wrap(500, "failed to log share view", err)
+	}
+	return nil
+}
+
+// ListSharesByUser returns the shares the user created with view and
+// download totals.
+func (r *Repository) ListSharesByUser(userID uuid.UUID, q ShareListQuery) ([]*ShareSummary, error) {
+	where := "WHERE s.user_id = $1"
+	args := []interface{}{userID}
+	order := "s.created_at DESC"
+	if q.UpcomingOnly {
+		where += " AND s.valid_from > $2"
+		args = append(args, time.Now())
+		order = "s.valid_from"
+	}
+
+	query := `
+		SELECT ` + prefixColumns("s", shareColumns) + `, COALESCE(f.name, fo.name, ''),
+		       (SELECT COUNT(*) FROM share_views v WHERE v.share_id = s.id),
+		       (SELECT COUNT(*) FROM download_logs d WHERE d.share_id = s.id)
+		FROM file_shares s
+		LEFT JOIN files f ON f.id = s.file_id
+		LEFT JOIN folders fo ON fo.id = s.folder_id
+		` + where + `
+		ORDER BY ` + order
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list shares", err)
+	}
+	defer rows.Close()
+
+	shares := []*ShareSummary{}
+	for rows.Next() {
+		summary := &ShareSummary{}
+		share, err := scanShare(rows, &summary.TargetName, &summary.Views, &summary.Downloads)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan share", err)
+		}
+		summary.FileShare = *share
+		shares = append(shares, summary)
+	}
+	return shares, nil
+}
+
+// GetAccessStats aggregates views and downloads for a file or a share over a
+// time range into daily buckets, unique visitors and top referrers and user
+// agents. Views only exist for share links; downloads of a file include
+// direct and shared downloads.
+func (r *Repository) GetAccessStats(q AccessQuery) (*AccessStats, error) {
+	column, id := "file_id", q.FileID
+	if q.ShareID != nil {
+		column, id = "share_id", q.ShareID
+	}
+
+	// $1 = id, $2 = from, $3 = to
+	events := fmt.Sprintf(`
+		SELECT 'view' AS event, viewed_at AS at, ip_hash, referrer, user_agent
+		FROM share_views WHERE %[1]s = $1 AND viewed_at >= $2 AND viewed_at < $3
+		UNION ALL
+		SELECT 'download', downloaded_at, ip_hash, referrer, user_agent
+		FROM download_logs WHERE %[1]s = $1 AND downloaded_at >= $2 AND downloaded_at < $3
+	`, column)
+	args := []interface{}{*id, q.From, q.To}
+
+	stats := &AccessStats{
+		From:          q.From,
+		To:            q.To,
+		Daily:         []DailyAccess{},
+		TopReferrers:  []RankedValue{},
+		TopUserAgents: []RankedValue{},
+	}
+
+	totals := `
+		SELECT COUNT(*) FILTER (WHERE event = 'view'),
+		       COUNT(*) FILTER (WHERE event = 'download'),
+		       COUNT(DISTINCT ip_hash)
+		FROM (` + events + `) e`
+	err := r.db.QueryRow(totals, args...).Scan(&stats.Views, &stats.Downloads, &stats.UniqueVisitors)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to aggregate access totals", err)
+	}
+
+	daily := `
+		SELECT to_char(d.day, 'YYYY-MM-DD'),
+		       COUNT(e.event) FILTER (WHERE e.event = 'view'),
+		       COUNT(e.event) FILTER (WHERE e.event = 'download')
+		FROM generate_series(date_trunc('day', $2::timestamp), $3::timestamp - interval '1 microsecond', interval '1 day') AS d(day)
+		LEFT JOIN (` + events + `) e ON date_trunc('day', e.at) = d.day
+		GROUP BY d.day
+		ORDER BY d.day`
+	rows, err := r.db.Query(daily, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to aggregate daily access", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket DailyAccess
+		if err := rows.Scan(&bucket.Day, &bucket.Views, &bucket.Downloads); err != nil {
+			return nil, errors.Wrap(500, "failed to scan daily access", err)
+		}
+		stats.Daily = append(stats.Daily, bucket)
+	}
+
+	if q.FileID != nil {
+		if err := r.addArchivedDownloads(stats, *q.FileID); err != nil {
+			return nil, err
+		}
+	}
+
+	if stats.TopReferrers, err = r.topAccessValues(events, "referrer", args); err != nil {
+		return nil, err
+	}
+	if stats.TopUserAgents, err = r.topAccessValues(events, "user_agent", args); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// addArchivedDownloads adds the daily counts kept for a file's pruned
+// downloads to its stats. Unique visitors only cover retained rows.
+func (r *Repository) addArchivedDownloads(stats *AccessStats, fileID uuid.UUID) error {
+	archived, err := r.ListArchivedDownloads(&DownloadQuery{FileID: &fileID, From: &stats.From, To: &stats.To})
+	if err != nil {
+		return err
+	}
+	for _, day := range archived {
+		stats.Downloads += day.Downloads
+		for i := range stats.Daily {
+			if stats.Daily[i].Day == day.Day {
+				stats.Daily[i].Downloads += day.Downloads
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) topAccessValues(events, column string, args []interface{}) ([]RankedValue, error) {
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*)
+		FROM (%[2]s) e
+		WHERE COALESCE(%[1]s, '') <> ''
+		GROUP BY %[1]s
+		ORDER BY COUNT(*) DESC, %[1]s
+		LIMIT 10`, column, events)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to rank "+column, err)
+	}
+	defer rows.Close()
+
+	values := []RankedValue{}
+	for rows.Next() {
+		var v RankedValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, errors.Wrap(500, "failed to scan "+column, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// ListShareAccesses returns the most recent views and downloads through a
+// share, newest first, with the account email of signed-in visitors.
+func (r *Repository) ListShareAccesses(shareID uuid.UUID, page, pageSize int) ([]*AccessEntry, int, error) {
+	events := `
+		SELECT 'view' AS event, share_id, user_id, ip_address, user_agent, referrer, viewed_at AS at
+		FROM share_views WHERE share_id = $1
+		UNION ALL
+		SELECT 'download', share_id, user_id, ip_address, user_agent, referrer, downloaded_at
+		FROM download_logs WHERE share_id = $1
+	`
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM (`+events+`) e`, shareID).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(500, "failed to count share accesses", err)
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	query := `
+		SELECT e.event, e.share_id, COALESCE(u.email, ''), COALESCE(e.ip_address, ''),
+		       COALESCE(e.user_agent, ''), COALESCE(e.referrer, ''), e.at
+		FROM (` + events + `) e
+		LEFT JOIN users u ON u.id = e.user_id
+		ORDER BY e.at DESC
+		LIMIT $2 OFFSET $3`
+	rows, err := r.db.Query(query, shareID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, errors.Wrap(500, "failed to list share accesses", err)
+	}
+	defer rows.Close()
+
+	entries := []*AccessEntry{}
+	for rows.Next() {
+		entry := &AccessEntry{}
+		err := rows.Scan(&entry.Event, &entry.ShareID, &entry.UserEmail, &entry.IPAddress,
+			&entry.UserAgent, &entry.Referrer, &entry.AccessedAt)
+		if err != nil {
+			return nil, 0, errors.Wrap(500, "failed to scan share access", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
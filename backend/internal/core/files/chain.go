@@ -0,0 +1,149 @@
+package files
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/hashchain"
+)
+
+// DownloadChain names the download log's hash chain.
+const DownloadChain = "downloads"
+
+// chainFields are the contents a download's hash covers. The IP address
+// and its hash are left out so the privacy policy can redact them.
+func (d *DownloadLog) chainFields() []string {
+	userID, shareID, downloadedAt := "", "", ""
+	if d.UserID != uuid.Nil {
+		userID = d.UserID.String()
+	}
+	if d.ShareID != nil {
+		shareID = d.ShareID.String()
+	}
+	if !d.DownloadedAt.IsZero() {
+		downloadedAt = hashchain.Time(d.DownloadedAt)
+	}
+	return []string{d.ID.String(), d.FileID.String(), userID, shareID, d.UserAgent, d.Referrer, downloadedAt}
+}
+
+// Rows from before migrations 003 and 020 may have NULLs in these columns.
+const downloadChainColumns = `id, file_id, user_id, share_id, COALESCE(user_agent, ''), COALESCE(referrer, ''),
+	downloaded_at`
+
+func scanChainedDownload(row rowScanner, extra ...interface{}) (*DownloadLog, error) {
+	d := &DownloadLog{}
+	var userID, shareID uuid.NullUUID
+	var downloadedAt sql.NullTime
+	dest := append([]interface{}{&d.ID, &d.FileID, &userID, &shareID, &d.UserAgent, &d.Referrer, &downloadedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		d.UserID = userID.UUID
+	}
+	if shareID.Valid {
+		d.ShareID = &shareID.UUID
+	}
+	if downloadedAt.Valid {
+		d.DownloadedAt = downloadedAt.Time
+	}
+	return d, nil
+}
+
+// DownloadChainHead returns the last download in the hash chain, or nil if
+// the log is empty.
+func (r *Repository) DownloadChainHead() (*hashchain.Link, error) {
+	head, err := hashchain.Head(r.db, "download_logs")
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to read download chain", err)
+	}
+	return head, nil
+}
+
+// LinkUnchainedDownloads adds downloads logged before the log was chained,
+// oldest first. It returns how many were linked.
+func (r *Repository) LinkUnchainedDownloads() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to link downloads", err)
+	}
+	defer tx.Rollback()
+
+	if err := hashchain.Lock(tx, DownloadChain); err != nil {
+		return 0, errors.Wrap(500, "failed to lock download chain", err)
+	}
+	head, err := hashchain.Head(tx, "download_logs")
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to read download chain", err)
+	}
+
+	query := `SELECT ` + downloadChainColumns + ` FROM download_logs WHERE seq IS NULL ORDER BY downloaded_at NULLS FIRST, id`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to list unchained downloads", err)
+	}
+	var links []hashchain.Link
+	var ids []uuid.UUID
+	for rows.Next() {
+		d, err := scanChainedDownload(rows)
+		if err != nil {
+			rows.Close()
+			return 0, errors.Wrap(500, "failed to scan download", err)
+		}
+		link := hashchain.Next(head, d.chainFields()...)
+		head = &link
+		links = append(links, link)
+		ids = append(ids, d.ID)
+	}
+	rows.Close()
+
+	for i, link := range links {
+		_, err := tx.Exec(`UPDATE download_logs SET seq = $1, prev_hash = $2, hash = $3 WHERE id = $4`,
+			link.Seq, link.PrevHash, link.Hash, ids[i])
+		if err != nil {
+			return 0, errors.Wrap(500, "failed to link download", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(500, "failed to link downloads", err)
+	}
+	return len(links), nil
+}
+
+// EachLinkedDownload calls fn for every chained download in sequence
+// order, with the contents its hash should cover.
+func (r *Repository) EachLinkedDownload(fn func(hashchain.Record) error) error {
+	query := `SELECT ` + downloadChainColumns + `, seq, prev_hash, hash FROM download_logs WHERE seq IS NOT NULL ORDER BY seq`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return errors.Wrap(500, "failed to read download chain", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link hashchain.Link
+		d, err := scanChainedDownload(rows, &link.Seq, &link.PrevHash, &link.Hash)
+		if err != nil {
+			return errors.Wrap(500, "failed to scan download", err)
+		}
+		if err := fn(hashchain.Record{ID: d.ID.String(), Link: link, Fields: d.chainFields()}); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(500, "failed to read download chain", err)
+	}
+	return nil
+}
+
+// CountUnchainedDownloads returns how many downloads are outside the
+// chain. After LinkUnchainedDownloads has run, any such row was written
+// around the application.
+func (r *Repository) CountUnchainedDownloads() (int, error) {
+	var n int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM download_logs WHERE seq IS NULL`).Scan(&n); err != nil {
+		return 0, errors.Wrap(500, "failed to count unchained downloads", err)
+	}
+	return n, nil
+}
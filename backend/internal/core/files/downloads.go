@@ -0,0 +1,158 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// DownloadQuery filters the download log. File owners query with FileID
+// set to one of their files; admins may leave every filter empty.
+type DownloadQuery struct {
+	FileID   *uuid.UUID `form:"-"`
+	UserID   *uuid.UUID `form:"-"`
+	ShareID  *uuid.UUID `form:"-"`
+	From     *time.Time `form:"from"`
+	To       *time.Time `form:"to"`
+	Page     int        `form:"page"`
+	PageSize int        `form:"page_size"`
+}
+
+// DownloadEntry is one logged download. IPAddress is truncated or hashed
+// once the row is older than the anonymization period.
+type DownloadEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	FileID       uuid.UUID  `json:"file_id"`
+	FileName     string     `json:"file_name,omitempty"` // empty once the file is deleted
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	UserEmail    string     `json:"user_email,omitempty"`
+	ShareID      *uuid.UUID `json:"share_id,omitempty"`
+	IPAddress    string     `json:"ip_address"`
+	UserAgent    string     `json:"user_agent"`
+	Referrer     string     `json:"referrer,omitempty"`
+	DownloadedAt time.Time  `json:"downloaded_at"`
+}
+
+// DailyDownloads is the number of downloads of a file on a day whose
+// individual rows were removed by the retention policy.
+type DailyDownloads struct {
+	FileID    uuid.UUID `json:"file_id"`
+	Day       string    `json:"day"`
+	Downloads int       `json:"downloads"`
+}
+
+func (q *DownloadQuery) filter() (string, []interface{}) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.FileID != nil {
+		args = append(args, *q.FileID)
+		where = append(where, fmt.Sprintf("d.file_id = $%d", len(args)))
+	}
+	if q.UserID != nil {
+		args = append(args, *q.UserID)
+		where = append(where, fmt.Sprintf("d.user_id = $%d", len(args)))
+	}
+	if q.ShareID != nil {
+		args = append(args, *q.ShareID)
+		where = append(where, fmt.Sprintf("d.share_id = $%d", len(args)))
+	}
+	if q.From != nil {
+		args = append(args, *q.From)
+		where = append(where, fmt.Sprintf("d.downloaded_at >= $%d", len(args)))
+	}
+	if q.To != nil {
+		args = append(args, *q.To)
+		where = append(where, fmt.Sprintf("d.downloaded_at < $%d", len(args)))
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// ListDownloads returns one page of matching downloads, newest first, and
+// the total number of matches.
+func (r *Repository) ListDownloads(q *DownloadQuery) ([]*DownloadEntry, int, error) {
+	filter, args := q.filter()
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM download_logs d WHERE `+filter, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(500, "failed to count downloads", err)
+	}
+
+	args = append(args, q.PageSize, (q.Page-1)*q.PageSize)
+	query := fmt.Sprintf(`
+		SELECT d.id, d.file_id, COALESCE(f.name, ''), d.user_id, COALESCE(u.email, ''), d.share_id,
+		       COALESCE(d.ip_address, ''), COALESCE(d.user_agent, ''), COALESCE(d.referrer, ''), d.downloaded_at
+		FROM download_logs d
+		LEFT JOIN files f ON f.id = d.file_id
+		LEFT JOIN users u ON u.id = d.user_id
+		WHERE %s
+		ORDER BY d.downloaded_at DESC, d.id
+		LIMIT $%d OFFSET $%d`, filter, len(args)-1, len(args))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(500, "failed to list downloads", err)
+	}
+	defer rows.Close()
+
+	entries := []*DownloadEntry{}
+	for rows.Next() {
+		entry := &DownloadEntry{}
+		var userID, shareID uuid.NullUUID
+		err := rows.Scan(&entry.ID, &entry.FileID, &entry.FileName, &userID, &entry.UserEmail, &shareID,
+			&entry.IPAddress, &entry.UserAgent, &entry.Referrer, &entry.DownloadedAt)
+		if err != nil {
+			return nil, 0, errors.Wrap(500, "failed to scan download", err)
+		}
+		if userID.Valid {
+			entry.UserID = &userID.UUID
+		}
+		if shareID.Valid {
+			entry.ShareID = &shareID.UUID
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
+
+// ListArchivedDownloads returns the daily counts kept for downloads the
+// retention policy removed, oldest first. Only the file and time range of
+// q apply; the counts do not record who downloaded.
+func (r *Repository) ListArchivedDownloads(q *DownloadQuery) ([]DailyDownloads, error) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.FileID != nil {
+		args = append(args, *q.FileID)
+		where = append(where, fmt.Sprintf("file_id = $%d", len(args)))
+	}
+	if q.From != nil {
+		args = append(args, q.From.Format("2006-01-02"))
+		where = append(where, fmt.Sprintf("day >= $%d::date", len(args)))
+	}
+	if q.To != nil {
+		args = append(args, *q.To)
+		where = append(where, fmt.Sprintf("day < $%d", len(args)))
+	}
+
+	query := `
+		SELECT file_id, to_char(day, 'YYYY-MM-DD'), downloads
+		FROM download_daily_counts
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY day, file_id`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list archived downloads", err)
+	}
+	defer rows.Close()
+
+	counts := []DailyDownloads{}
+	for rows.Next() {
+		var c DailyDownloads
+		if err := rows.Scan(&c.FileID, &c.Day, &c.Downloads); err != nil {
+			return nil, errors.Wrap(500, "failed to scan archived downloads", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
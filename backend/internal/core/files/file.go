@@ -7,15 +7,17 @@ import (
 )
 
 type File struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	FileContentID uuid.UUID `json:"file_content_id"`
-	Name          string    `json:"name"`
-	MimeType      string    `json:"mime_type"`
-	IsPublic      bool      `json:"is_public"`
-	Size          int64     `json:"size"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uuid.UUID  `json:"id"`
+	UserID        uuid.UUID  `json:"user_id"`
+	OrgID         *uuid.UUID `json:"org_id,omitempty"` // set when an organization owns the file
+	FileContentID uuid.UUID  `json:"file_content_id"`
+	FolderID      *uuid.UUID `json:"folder_id,omitempty"`
+	Name          string     `json:"name"`
+	MimeType      string     `json:"mime_type"`
+	IsPublic      bool       `json:"is_public"`
+	Size          int64      `json:"size"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 type FileContent struct {
@@ -26,25 +28,75 @@ type FileContent struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Share target types. A share points at a single file, a folder (and
+// everything below it) or an ad-hoc collection of files.
+const (
+	ShareTargetFile       = "file"
+	ShareTargetFolder     = "folder"
+	ShareTargetCollection = "collection"
+)
+
 type FileShare struct {
-	ID         uuid.UUID  `json:"id"`
-	FileID     uuid.UUID  `json:"file_id"`
-	ShareToken string     `json:"share_token"`
-	IsPublic   bool       `json:"is_public"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
+	ID                uuid.UUID   `json:"id"`
+	UserID            uuid.UUID   `json:"user_id"`
+	TargetType        string      `json:"target_type"`
+	FileID            *uuid.UUID  `json:"file_id,omitempty"`
+	FolderID          *uuid.UUID  `json:"folder_id,omitempty"`
+	FileIDs           []uuid.UUID `json:"file_ids,omitempty"`
+	ShareToken        string      `json:"share_token"`
+	IsPublic          bool        `json:"is_public"`
+	PasswordHash      string      `json:"-"`
+	PasswordProtected bool        `json:"password_protected"`
+	ValidFrom         *time.Time  `json:"valid_from,omitempty"`
+	ExpiresAt         *time.Time  `json:"expires_at,omitempty"`
+	CreatedAt         time.Time   `json:"created_at"`
+}
+
+// CreateShareRequest is the body of a share creation. Target fields are
+// only read when creating folder or collection shares.
+type CreateShareRequest struct {
+	TargetType string      `json:"target_type"`
+	FolderID   *uuid.UUID  `json:"folder_id"`
+	FileIDs    []uuid.UUID `json:"file_ids"`
+	IsPublic   bool        `json:"is_public"`
+	ValidFrom  *time.Time  `json:"valid_from,omitempty"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+	Password   string      `json:"password"`
+}
+
+type ShareListQuery struct {
+	// UpcomingOnly limits the list to embargoed shares whose valid_from is
+	// still in the future.
+	UpcomingOnly bool
+}
+
+type DownloadLog struct {
+	ID           uuid.UUID // set by LogDownload, like IPHash and DownloadedAt
+	FileID       uuid.UUID
+	UserID       uuid.UUID // uuid.Nil for anonymous downloads
+	ShareID      *uuid.UUID
+	IPAddress    string
+	IPHash       string
+	UserAgent    string
+	Referrer     string
+	DownloadedAt time.Time
 }
 
 type UploadRequest struct {
 	Name     string `form:"name" binding:"required"`
 	IsPublic bool   `form:"is_public"`
+	FolderID string `form:"folder_id"`
+	OrgID    string `form:"org_id"`
 }
 
+// FileListQuery filters a listing. Without OrgID it lists the user's
+// personal files; with OrgID, the organization's files.
 type FileListQuery struct {
+	OrgID    *uuid.UUID
 	Search   string
 	MimeType string
 	IsPublic *bool
+	FolderID *uuid.UUID
 	Page     int
 	PageSize int
 }
-
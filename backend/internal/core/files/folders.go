@@ -0,0 +1,84 @@
+package files
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+type Folder struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	OrgID     *uuid.UUID `json:"org_id,omitempty"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (r *Repository) CreateFolder(folder *Folder) error {
+	query := `
+		INSERT INTO folders (id, user_id, org_id, parent_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(query, folder.ID, folder.UserID, folder.OrgID, folder.ParentID, folder.Name,
+		folder.CreatedAt, folder.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create folder", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetFolderByID(id uuid.UUID) (*Folder, error) {
+	query := `
+		SELECT id, user_id, org_id, parent_id, name, created_at, updated_at
+		FROM folders
+		WHERE id = $1
+	`
+	folder := &Folder{}
+	err := r.db.QueryRow(query, id).Scan(
+		&folder.ID, &folder.UserID, &folder.OrgID, &folder.ParentID, &folder.Name,
+		&folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get folder", err)
+	}
+	return folder, nil
+}
+
+// ListFolders returns the folders directly below parentID, or the
+// top-level folders when parentID is nil. The scope is the user's personal
+// folders, or the organization's when orgID is set.
+func (r *Repository) ListFolders(userID uuid.UUID, orgID, parentID *uuid.UUID) ([]*Folder, error) {
+	query := `
+		SELECT id, user_id, org_id, parent_id, name, created_at, updated_at
+		FROM folders
+		WHERE parent_id IS NOT DISTINCT FROM $3
+		  AND (($2::uuid IS NULL AND user_id = $1 AND org_id IS NULL) OR org_id = $2)
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query, userID, orgID, parentID)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list folders", err)
+	}
+	defer rows.Close()
+
+	folders := []*Folder{}
+	for rows.Next() {
+		folder := &Folder{}
+		err := rows.Scan(
+			&folder.ID, &folder.UserID, &folder.OrgID, &folder.ParentID, &folder.Name,
+			&folder.CreatedAt, &folder.UpdatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan folder", err)
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
@@ -0,0 +1,255 @@
+package files
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Hold kinds. A legal hold lasts until an admin releases it; a retention
+// lock cannot be released and only ends at its retain-until time.
+const (
+	HoldKindLegal     = "legal_hold"
+	HoldKindRetention = "retention"
+)
+
+// Hold targets. A folder hold covers every file in the folder and its
+// subfolders, including files added later.
+const (
+	HoldTargetFile   = "file"
+	HoldTargetFolder = "folder"
+)
+
+var (
+	ErrFileHeld          = errors.New(423, "file is under legal hold or retention lock")
+	ErrHoldReleased      = errors.New(409, "hold already released")
+	ErrRetentionLocked   = errors.New(409, "retention locks cannot be released before they expire")
+	ErrHoldNotExtendable = errors.New(409, "only active retention locks can be extended")
+	ErrRetentionNotLater = errors.New(400, "retain_until must be later than the current one")
+)
+
+// activeHold matches holds in force in queries over legal_holds h. The
+// placeholder is the current time.
+const activeHold = `h.released_at IS NULL AND (h.retain_until IS NULL OR h.retain_until > $%d)`
+
+// fileHeld matches files covered by an active hold, directly or through a
+// folder above them, in queries over files f. The placeholder is the
+// current time.
+const fileHeld = `EXISTS (
+	WITH RECURSIVE up(id) AS (
+		SELECT f.folder_id
+		UNION ALL
+		SELECT p.parent_id FROM folders p JOIN up ON p.id = up.id WHERE p.parent_id IS NOT NULL
+	)
+	SELECT 1 FROM legal_holds h
+	WHERE ` + activeHold + `
+	  AND (h.file_id = f.id OR h.folder_id IN (SELECT id FROM up))
+)`
+
+// Hold keeps a file, or every file below a folder, from being deleted.
+type Hold struct {
+	ID            uuid.UUID  `json:"id"`
+	Kind          string     `json:"kind"`
+	TargetType    string     `json:"target_type"`
+	FileID        *uuid.UUID `json:"file_id,omitempty"`
+	FolderID      *uuid.UUID `json:"folder_id,omitempty"`
+	TargetName    string     `json:"target_name,omitempty"` // empty once the target is gone
+	Reason        string     `json:"reason"`
+	RetainUntil   *time.Time `json:"retain_until,omitempty"`
+	Status        string     `json:"status"` // active, released or expired
+	CreatedBy     *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReleasedBy    *uuid.UUID `json:"released_by,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+	ReleaseReason string     `json:"release_reason,omitempty"`
+}
+
+// CreateHoldRequest names either a file or a folder. Retention locks need
+// retain_until; legal holds must not have one.
+type CreateHoldRequest struct {
+	Kind        string     `json:"kind" binding:"required,oneof=legal_hold retention"`
+	FileID      *uuid.UUID `json:"file_id"`
+	FolderID    *uuid.UUID `json:"folder_id"`
+	Reason      string     `json:"reason" binding:"required,max=2000"`
+	RetainUntil *time.Time `json:"retain_until"`
+}
+
+type ReleaseHoldRequest struct {
+	Reason string `json:"reason" binding:"max=2000"`
+}
+
+type ExtendHoldRequest struct {
+	RetainUntil time.Time `json:"retain_until" binding:"required"`
+}
+
+const holdColumns = `h.id, h.kind, h.target_type, h.file_id, h.folder_id, COALESCE(fi.name, fo.name, ''), h.reason,
+	h.retain_until, h.created_by, h.created_at, h.released_by, h.released_at, h.release_reason`
+
+const holdFrom = `legal_holds h
+	LEFT JOIN files fi ON fi.id = h.file_id
+	LEFT JOIN folders fo ON fo.id = h.folder_id`
+
+func scanHold(row rowScanner) (*Hold, error) {
+	h := &Hold{}
+	var fileID, folderID, createdBy, releasedBy uuid.NullUUID
+	var retainUntil, releasedAt sql.NullTime
+	err := row.Scan(&h.ID, &h.Kind, &h.TargetType, &fileID, &folderID, &h.TargetName, &h.Reason,
+		&retainUntil, &createdBy, &h.CreatedAt, &releasedBy, &releasedAt, &h.ReleaseReason)
+	if err != nil {
+		return nil, err
+	}
+	if fileID.Valid {
+		h.FileID = &fileID.UUID
+	}
+	if folderID.Valid {
+		h.FolderID = &folderID.UUID
+	}
+	if createdBy.Valid {
+		h.CreatedBy = &createdBy.UUID
+	}
+	if releasedBy.Valid {
+		h.ReleasedBy = &releasedBy.UUID
+	}
+	h.Status = "active"
+	if retainUntil.Valid {
+		h.RetainUntil = &retainUntil.Time
+		if !retainUntil.Time.After(time.Now()) {
+			h.Status = "expired"
+		}
+	}
+	if releasedAt.Valid {
+		h.ReleasedAt = &releasedAt.Time
+		h.Status = "released"
+	}
+	return h, nil
+}
+
+func (r *Repository) CreateHold(h *Hold) error {
+	query := `
+		INSERT INTO legal_holds (id, kind, target_type, file_id, folder_id, reason, retain_until, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(query, h.ID, h.Kind, h.TargetType, h.FileID, h.FolderID, h.Reason, h.RetainUntil, h.CreatedBy, h.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create hold", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetHold(id uuid.UUID) (*Hold, error) {
+	h, err := scanHold(r.db.QueryRow(`SELECT `+holdColumns+` FROM `+holdFrom+` WHERE h.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get hold", err)
+	}
+	return h, nil
+}
+
+// ListHolds returns holds newest first, optionally only those of one kind
+// and with status "active", "released" or "expired".
+func (r *Repository) ListHolds(kind, status string) ([]*Hold, error) {
+	args := []interface{}{time.Now()}
+	query := `SELECT ` + holdColumns + ` FROM ` + holdFrom + ` WHERE TRUE`
+	switch status {
+	case "active":
+		query += ` AND ` + fmt.Sprintf(activeHold, 1)
+	case "released":
+		query += ` AND h.released_at IS NOT NULL`
+	case "expired":
+		query += ` AND h.released_at IS NULL AND h.retain_until <= $1`
+	}
+	if kind != "" {
+		args = append(args, kind)
+		query += fmt.Sprintf(` AND h.kind = $%d`, len(args))
+	}
+	query += ` ORDER BY h.created_at DESC LIMIT 500`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list holds", err)
+	}
+	defer rows.Close()
+
+	holds := []*Hold{}
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan hold", err)
+		}
+		holds = append(holds, h)
+	}
+	return holds, nil
+}
+
+// ReleaseHold ends a legal hold. Retention locks cannot be released.
+func (r *Repository) ReleaseHold(id, releasedBy uuid.UUID, reason string) error {
+	query := `
+		UPDATE legal_holds SET released_at = $1, released_by = $2, release_reason = $3
+		WHERE id = $4 AND kind = 'legal_hold' AND released_at IS NULL
+	`
+	result, err := r.db.Exec(query, time.Now(), releasedBy, reason, id)
+	if err != nil {
+		return errors.Wrap(500, "failed to release hold", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		h, err := r.GetHold(id)
+		if err != nil {
+			return err
+		}
+		if h.Kind == HoldKindRetention {
+			return ErrRetentionLocked
+		}
+		return ErrHoldReleased
+	}
+	return nil
+}
+
+// ExtendHold moves an active retention lock's end later. It can never be
+// moved earlier.
+func (r *Repository) ExtendHold(id uuid.UUID, until time.Time) error {
+	h, err := r.GetHold(id)
+	if err != nil {
+		return err
+	}
+	if h.Kind != HoldKindRetention || h.Status != "active" {
+		return ErrHoldNotExtendable
+	}
+	if !until.After(*h.RetainUntil) {
+		return ErrRetentionNotLater
+	}
+
+	query := `UPDATE legal_holds SET retain_until = $1 WHERE id = $2 AND retain_until < $1`
+	if _, err := r.db.Exec(query, until, id); err != nil {
+		return errors.Wrap(500, "failed to extend retention lock", err)
+	}
+	return nil
+}
+
+// CountHoldFiles returns how many files the hold covers.
+func (r *Repository) CountHoldFiles(h *Hold) (int, error) {
+	if h.TargetType == HoldTargetFile {
+		return 1, nil
+	}
+	query := `
+		WITH RECURSIVE down(id) AS (
+			SELECT $1::uuid
+			UNION ALL
+			SELECT c.id FROM folders c JOIN down ON c.parent_id = down.id
+		)
+		SELECT COUNT(*) FROM files WHERE folder_id IN (SELECT id FROM down)
+	`
+	var n int
+	if err := r.db.QueryRow(query, *h.FolderID).Scan(&n); err != nil {
+		return 0, errors.Wrap(500, "failed to count held files", err)
+	}
+	return n, nil
+}
@@ -13,18 +13,36 @@ package files
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/db/postgres"
 	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/hashchain"
 )
 
 type Repository struct {
-	db *sql.DB
+	db    *sql.DB
+	ipKey []byte // keys IP hashes and hashed anonymized IPs
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+func NewRepository(db *sql.DB, ipHashKey string) *Repository {
+	return &Repository{db: db, ipKey: []byte(ipHashKey)}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// prefixColumns qualifies a comma-separated column list with a table alias.
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, col := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(col)
+	}
+	return strings.Join(parts, ", ")
 }
 
 func (r *Repository) CreateFileContent(fc *FileContent) error {
@@ -78,12 +96,21 @@ func (r *Repository) GetFileContentByID(id uuid.UUID) (*FileContent, error) {
 	return fc, nil
 }
 
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (r *Repository) CreateFile(file *File) error {
+	return createFile(r.db, file)
+}
+
+func createFile(db execer, file *File) error {
 	query := `
-		INSERT INTO files (id, user_id, file_content_id, name, mime_type, is_public, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO files (id, user_id, org_id, file_content_id, folder_id, name, mime_type, is_public, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
-	_, err := r.db.Exec(query, file.ID, file.UserID, file.FileContentID, file.Name,
+	_, err := db.Exec(query, file.ID, file.UserID, file.OrgID, file.FileContentID, file.FolderID, file.Name,
 		file.MimeType, file.IsPublic, file.CreatedAt, file.UpdatedAt)
 	if err != nil {
 		return errors.Wrap(500, "failed to create file", err)
@@ -93,17 +120,12 @@ func (r *Repository) CreateFile(file *File) error {
 
 func (r *Repository) GetFileByID(id uuid.UUID) (*File, error) {
 	query := `
-		SELECT f.id, f.user_id, f.file_content_id, f.name, f.mime_type, f.is_public, 
-		       fc.size, f.created_at, f.updated_at
+		SELECT ` + fileColumns + `
 		FROM files f
 		JOIN file_contents fc ON f.file_content_id = fc.id
 		WHERE f.id = $1
 	`
-	file := &File{}
-	err := r.db.QueryRow(query, id).Scan(
-		&file.ID, &file.UserID, &file.FileContentID, &file.Name,
-		&file.MimeType, &file.IsPublic, &file.Size, &file.CreatedAt, &file.UpdatedAt,
-	)
+	file, err := scanFile(r.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, errors.ErrNotFound
 	}
@@ -114,8 +136,12 @@ func (r *Repository) GetFileByID(id uuid.UUID) (*File, error) {
 }
 
 func (r *Repository) ListFiles(userID uuid.UUID, query FileListQuery) ([]*File, int, error) {
-	where := "WHERE f.user_id = $1"
+	where := "WHERE f.user_id = $1 AND f.org_id IS NULL"
 	args := []interface{}{userID}
+	if query.OrgID != nil {
+		where = "WHERE f.org_id = $1"
+		args = []interface{}{*query.OrgID}
+	}
 	argIndex := 2
 
 	if query.Search != "" {
@@ -136,6 +162,12 @@ func (r *Repository) ListFiles(userID uuid.UUID, query FileListQuery) ([]*File,
 		argIndex++
 	}
 
+	if query.FolderID != nil {
+		where += fmt.Sprintf(" AND f.folder_id = $%d", argIndex)
+		args = append(args, *query.FolderID)
+		argIndex++
+	}
+
 	countQuery := fmt.Sprintf(`
 		SELECT COUNT(*)
 		FROM files f
@@ -156,8 +188,7 @@ func (r *Repository) ListFiles(userID uuid.UUID, query FileListQuery) ([]*File,
 	offset := (query.Page - 1) * query.PageSize
 
 	listQuery := fmt.Sprintf(`
-		SELECT f.id, f.user_id, f.file_content_id, f.name, f.mime_type, f.is_public,
-		       fc.size, f.created_at, f.updated_at
+		SELECT `+fileColumns+`
 		FROM files f
 		JOIN file_contents fc ON f.file_content_id = fc.id
 		%s
@@ -174,11 +205,7 @@ func (r *Repository) ListFiles(userID uuid.UUID, query FileListQuery) ([]*File,
 
 	var files []*File
 	for rows.Next() {
-		file := &File{}
-		err := rows.Scan(
-			&file.ID, &file.UserID, &file.FileContentID, &file.Name,
-			&file.MimeType, &file.IsPublic, &file.Size, &file.CreatedAt, &file.UpdatedAt,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, 0, errors.Wrap(500, "failed to scan file", err)
 		}
@@ -188,9 +215,15 @@ func (r *Repository) ListFiles(userID uuid.UUID, query FileListQuery) ([]*File,
 	return files, total, nil
 }
 
+// DeleteFile deletes a file, failing with ErrFileHeld while a legal hold
+// or retention lock covers it.
 func (r *Repository) DeleteFile(id uuid.UUID) error {
-	query := `DELETE FROM files WHERE id = $1`
-	result, err := r.db.Exec(query, id)
+	query := `DELETE FROM files f WHERE f.id = $1 AND NOT ` + fmt.Sprintf(fileHeld, 2)
+	result, err := r.db.Exec(query, id, time.Now())
+	if postgres.IsHoldViolation(err) {
+		// A hold placed while the file was being deleted.
+		return ErrFileHeld
+	}
 	if err != nil {
 		return errors.Wrap(500, "failed to delete file", err)
 	}
@@ -199,48 +232,203 @@ func (r *Repository) DeleteFile(id uuid.UUID) error {
 		return errors.Wrap(500, "failed to get rows affected", err)
 	}
 	if rowsAffected == 0 {
-		return errors.ErrNotFound
+		if _, err := r.GetFileByID(id); err != nil {
+			return err
+		}
+		return ErrFileHeld
 	}
 	return nil
 }
 
 func (r *Repository) CreateShare(share *FileShare) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to create share", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO file_shares (id, file_id, share_token, is_public, expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO file_shares (id, user_id, target_type, file_id, folder_id, share_token,
+		                         is_public, password_hash, valid_from, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	_, err := r.db.Exec(query, share.ID, share.FileID, share.ShareToken, share.IsPublic,
-		share.ExpiresAt, share.CreatedAt)
+	_, err = tx.Exec(query, share.ID, share.UserID, share.TargetType, share.FileID, share.FolderID,
+		share.ShareToken, share.IsPublic, sql.NullString{String: share.PasswordHash, Valid: share.PasswordHash != ""},
+		share.ValidFrom, share.ExpiresAt, share.CreatedAt)
 	if err != nil {
 		return errors.Wrap(500, "failed to create share", err)
 	}
+
+	for _, fileID := range share.FileIDs {
+		_, err := tx.Exec(`INSERT INTO share_items (share_id, file_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			share.ID, fileID)
+		if err != nil {
+			return errors.Wrap(500, "failed to add file to share", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to create share", err)
+	}
 	return nil
 }
 
-func (r *Repository) GetShareByToken(token string) (*FileShare, error) {
-	query := `
-		SELECT id, file_id, share_token, is_public, expires_at, created_at
-		FROM file_shares
-		WHERE share_token = $1
-	`
+const shareColumns = `id, user_id, target_type, file_id, folder_id, share_token, is_public,
+		password_hash, valid_from, expires_at, created_at`
+
+// scanShare scans the shareColumns of a row followed by any extra columns.
+func scanShare(row rowScanner, extra ...interface{}) (*FileShare, error) {
 	share := &FileShare{}
-	var expiresAt sql.NullTime
-	err := r.db.QueryRow(query, token).Scan(
-		&share.ID, &share.FileID, &share.ShareToken, &share.IsPublic,
-		&expiresAt, &share.CreatedAt,
-	)
+	var passwordHash sql.NullString
+	var validFrom, expiresAt sql.NullTime
+	dest := []interface{}{
+		&share.ID, &share.UserID, &share.TargetType, &share.FileID, &share.FolderID,
+		&share.ShareToken, &share.IsPublic, &passwordHash, &validFrom, &expiresAt, &share.CreatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	share.PasswordHash = passwordHash.String
+	share.PasswordProtected = passwordHash.Valid && passwordHash.String != ""
+	if validFrom.Valid {
+		share.ValidFrom = &validFrom.Time
+	}
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	return share, nil
+}
+
+func (r *Repository) GetShareByID(id uuid.UUID) (*FileShare, error) {
+	query := `SELECT ` + shareColumns + ` FROM file_shares WHERE id = $1`
+	share, err := scanShare(r.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, errors.ErrNotFound
 	}
 	if err != nil {
 		return nil, errors.Wrap(500, "failed to get share", err)
 	}
-	if expiresAt.Valid {
-		share.ExpiresAt = &expiresAt.Time
+	return share, nil
+}
+
+// DeleteShare removes a share link. Its views go with it; downloads made
+// through it stay in the download log.
+func (r *Repository) DeleteShare(id uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM file_shares WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(500, "failed to delete share", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) GetShareByToken(token string) (*FileShare, error) {
+	query := `SELECT ` + shareColumns + ` FROM file_shares WHERE share_token = $1`
+	share, err := scanShare(r.db.QueryRow(query, token))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get share", err)
 	}
 	return share, nil
 }
 
+const (
+	// Wrong share passwords older than this no longer count.
+	sharePasswordWindow = 15 * time.Minute
+
+	// Progressive delays from sharePasswordDelayAfter failures, then a
+	// lockout for the rest of the window.
+	sharePasswordDelayAfter = 5
+	sharePasswordLockAfter  = 20
+	sharePasswordMaxDelay   = time.Minute
+)
+
+// ReserveSharePasswordAttempt counts a password attempt against the share
+// before the password is checked, so concurrent guesses cannot all get in
+// under the limit. When the share is throttled nothing is counted and the
+// remaining wait is returned instead. A correct password clears the count
+// with ClearSharePasswordFailures.
+func (r *Repository) ReserveSharePasswordAttempt(shareID uuid.UUID) (time.Duration, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to check share password attempts", err)
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var last sql.NullTime
+	err = tx.QueryRow(`SELECT password_failures, password_failed_at FROM file_shares WHERE id = $1 FOR UPDATE`, shareID).
+		Scan(&failures, &last)
+	if err == sql.ErrNoRows {
+		return 0, errors.ErrNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to check share password attempts", err)
+	}
+
+	now := time.Now()
+	if !last.Valid || now.Sub(last.Time) > sharePasswordWindow {
+		failures = 0
+	}
+	if wait := sharePasswordWait(failures, last.Time, now); wait > 0 {
+		return wait, nil
+	}
+
+	_, err = tx.Exec(`UPDATE file_shares SET password_failures = $1, password_failed_at = $2 WHERE id = $3`,
+		failures+1, now, shareID)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to record share password attempt", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(500, "failed to record share password attempt", err)
+	}
+	return 0, nil
+}
+
+// ClearSharePasswordFailures forgets past wrong passwords once the right
+// one is given.
+func (r *Repository) ClearSharePasswordFailures(shareID uuid.UUID) error {
+	_, err := r.db.Exec(`UPDATE file_shares SET password_failures = 0, password_failed_at = NULL WHERE id = $1`, shareID)
+	if err != nil {
+		return errors.Wrap(500, "failed to clear share password attempts", err)
+	}
+	return nil
+}
+
+// sharePasswordWait is the remaining wait after failures wrong passwords,
+// the last at last. The delay doubles with each failure, capped at
+// sharePasswordMaxDelay, until the share locks for the rest of the window.
+func sharePasswordWait(failures int, last, now time.Time) time.Duration {
+	if failures < sharePasswordDelayAfter {
+		return 0
+	}
+
+	var until time.Time
+	if failures >= sharePasswordLockAfter {
+		until = last.Add(sharePasswordWindow)
+	} else {
+		delay := time.Second << uint(failures-sharePasswordDelayAfter)
+		if delay > sharePasswordMaxDelay {
+			delay = sharePasswordMaxDelay
+		}
+		until = last.Add(delay)
+	}
+
+	if wait := until.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
 // GetFileCountByContentID returns the number of files referencing a specific content.
 //
 // This is used to track deduplication efficiency and determine if content
@@ -270,15 +458,49 @@ func (r *Repository) GetFileCountByContentID(contentID uuid.UUID) (int, error) {
 	return count, nil
 }
 
-func (r *Repository) LogDownload(fileID, userID uuid.UUID, ipAddress, userAgent string) error {
+// LogDownload appends a download to the log and links it into the
+// downloads hash chain.
+func (r *Repository) LogDownload(entry *DownloadLog) error {
+	entry.ID = uuid.New()
+	entry.IPHash = r.hashIP(entry.IPAddress)
+	entry.DownloadedAt = time.Now().Truncate(time.Microsecond)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to log download", err)
+	}
+	defer tx.Rollback()
+
+	if err := hashchain.Lock(tx, DownloadChain); err != nil {
+		return errors.Wrap(500, "failed to lock download chain", err)
+	}
+	head, err := hashchain.Head(tx, "download_logs")
+	if err != nil {
+		return errors.Wrap(500, "failed to read download chain", err)
+	}
+	link := hashchain.Next(head, entry.chainFields()...)
+
 	query := `
-		INSERT INTO download_logs (id, file_id, user_id, ip_address, user_agent, downloaded_at)
-		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5)
+		INSERT INTO download_logs (id, file_id, user_id, share_id, ip_address, ip_hash, user_agent, referrer, downloaded_at,
+		                           seq, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	_, err := r.db.Exec(query, fileID, userID, ipAddress, userAgent, time.Now())
+	_, err = tx.Exec(query, entry.ID, entry.FileID, nullableUUID(entry.UserID), entry.ShareID, entry.IPAddress,
+		entry.IPHash, entry.UserAgent, entry.Referrer, entry.DownloadedAt, link.Seq, link.PrevHash, link.Hash)
 	if err != nil {
 		return errors.Wrap(500, "failed to log download", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to log download", err)
+	}
 	return nil
 }
 
+// nullableUUID maps uuid.Nil to NULL for optional references such as the
+// user of an anonymous download.
+func nullableUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,253 @@
+package files
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// FileRequest is an upload-only link that lets people without an account
+// upload into the owner's space. Uploads are charged to the owner's quota.
+type FileRequest struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	FolderID         *uuid.UUID `json:"folder_id,omitempty"`
+	Token            string     `json:"token"`
+	Title            string     `json:"title"`
+	MaxFileSize      *int64     `json:"max_file_size,omitempty"`
+	AllowedMimeTypes []string   `json:"allowed_mime_types,omitempty"`
+	MaxFiles         *int       `json:"max_files,omitempty"`
+	FilesReceived    int        `json:"files_received"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// FileRequestSubmission records one upload made through a file request.
+type FileRequestSubmission struct {
+	ID            uuid.UUID  `json:"id"`
+	FileRequestID uuid.UUID  `json:"file_request_id"`
+	FileID        *uuid.UUID `json:"file_id,omitempty"`
+	UploaderName  string     `json:"uploader_name,omitempty"`
+	UploaderEmail string     `json:"uploader_email,omitempty"`
+	IPAddress     string     `json:"ip_address"`
+	UserAgent     string     `json:"user_agent"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type CreateFileRequestRequest struct {
+	Title            string     `json:"title" binding:"required"`
+	FolderID         *uuid.UUID `json:"folder_id"`
+	MaxFileSize      *int64     `json:"max_file_size"`
+	AllowedMimeTypes []string   `json:"allowed_mime_types"`
+	MaxFiles         *int       `json:"max_files"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+}
+
+// Active reports whether the request still accepts uploads at time now.
+func (fr *FileRequest) Active(now time.Time) bool {
+	if fr.RevokedAt != nil {
+		return false
+	}
+	if fr.ExpiresAt != nil && now.After(*fr.ExpiresAt) {
+		return false
+	}
+	return fr.MaxFiles == nil || fr.FilesReceived < *fr.MaxFiles
+}
+
+const fileRequestColumns = `id, user_id, folder_id, token, title, max_file_size, allowed_mime_types,
+		       max_files, files_received, expires_at, revoked_at, created_at`
+
+func scanFileRequest(row rowScanner) (*FileRequest, error) {
+	fr := &FileRequest{}
+	var maxFileSize sql.NullInt64
+	var maxFiles sql.NullInt32
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&fr.ID, &fr.UserID, &fr.FolderID, &fr.Token, &fr.Title, &maxFileSize,
+		pq.Array(&fr.AllowedMimeTypes), &maxFiles, &fr.FilesReceived,
+		&expiresAt, &revokedAt, &fr.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if maxFileSize.Valid {
+		fr.MaxFileSize = &maxFileSize.Int64
+	}
+	if maxFiles.Valid {
+		n := int(maxFiles.Int32)
+		fr.MaxFiles = &n
+	}
+	if expiresAt.Valid {
+		fr.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		fr.RevokedAt = &revokedAt.Time
+	}
+	return fr, nil
+}
+
+func (r *Repository) CreateFileRequest(fr *FileRequest) error {
+	query := `
+		INSERT INTO file_requests (id, user_id, folder_id, token, title, max_file_size,
+		                           allowed_mime_types, max_files, files_received, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.Exec(query, fr.ID, fr.UserID, fr.FolderID, fr.Token, fr.Title, fr.MaxFileSize,
+		pq.Array(fr.AllowedMimeTypes), fr.MaxFiles, fr.FilesReceived, fr.ExpiresAt, fr.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create file request", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetFileRequestByToken(token string) (*FileRequest, error) {
+	query := `SELECT ` + fileRequestColumns + ` FROM file_requests WHERE token = $1`
+	fr, err := scanFileRequest(r.db.QueryRow(query, token))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get file request", err)
+	}
+	return fr, nil
+}
+
+func (r *Repository) GetFileRequestByID(id uuid.UUID) (*FileRequest, error) {
+	query := `SELECT ` + fileRequestColumns + ` FROM file_requests WHERE id = $1`
+	fr, err := scanFileRequest(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get file request", err)
+	}
+	return fr, nil
+}
+
+func (r *Repository) ListFileRequests(userID uuid.UUID) ([]*FileRequest, error) {
+	query := `SELECT ` + fileRequestColumns + ` FROM file_requests WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list file requests", err)
+	}
+	defer rows.Close()
+
+	requests := []*FileRequest{}
+	for rows.Next() {
+		fr, err := scanFileRequest(rows)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan file request", err)
+		}
+		requests = append(requests, fr)
+	}
+	return requests, nil
+}
+
+func (r *Repository) RevokeFileRequest(id uuid.UUID) error {
+	query := `UPDATE file_requests SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return errors.Wrap(500, "failed to revoke file request", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// ClaimFileRequestSlot reserves one upload against the request's file-count
+// limit. It returns false when the request is full, expired or revoked, so
+// concurrent uploads cannot overshoot the limit.
+func (r *Repository) ClaimFileRequestSlot(id uuid.UUID) (bool, error) {
+	query := `
+		UPDATE file_requests
+		SET files_received = files_received + 1
+		WHERE id = $1
+		  AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > $2)
+		  AND (max_files IS NULL OR files_received < max_files)
+	`
+	result, err := r.db.Exec(query, id, time.Now())
+	if err != nil {
+		return false, errors.Wrap(500, "failed to claim file request slot", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(500, "failed to get rows affected", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// ReleaseFileRequestSlot gives back a slot claimed for an upload that failed.
+func (r *Repository) ReleaseFileRequestSlot(id uuid.UUID) error {
+	query := `UPDATE file_requests SET files_received = files_received - 1 WHERE id = $1 AND files_received > 0`
+	if _, err := r.db.Exec(query, id); err != nil {
+		return errors.Wrap(500, "failed to release file request slot", err)
+	}
+	return nil
+}
+
+// CreateFileRequestSubmission creates the uploaded file and records the
+// submission together, so neither exists without the other.
+func (r *Repository) CreateFileRequestSubmission(file *File, sub *FileRequestSubmission) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := createFile(tx, file); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO file_request_submissions (id, file_request_id, file_id, uploader_name,
+		                                      uploader_email, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = tx.Exec(query, sub.ID, sub.FileRequestID, sub.FileID, sub.UploaderName,
+		sub.UploaderEmail, sub.IPAddress, sub.UserAgent, sub.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to record file request submission", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+func (r *Repository) ListFileRequestSubmissions(requestID uuid.UUID) ([]*FileRequestSubmission, error) {
+	query := `
+		SELECT id, file_request_id, file_id, COALESCE(uploader_name, ''), COALESCE(uploader_email, ''),
+		       COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM file_request_submissions
+		WHERE file_request_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, requestID)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list file request submissions", err)
+	}
+	defer rows.Close()
+
+	subs := []*FileRequestSubmission{}
+	for rows.Next() {
+		sub := &FileRequestSubmission{}
+		err := rows.Scan(
+			&sub.ID, &sub.FileRequestID, &sub.FileID, &sub.UploaderName, &sub.UploaderEmail,
+			&sub.IPAddress, &sub.UserAgent, &sub.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan file request submission", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
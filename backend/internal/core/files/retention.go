@@ -0,0 +1,175 @@
+package files
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/hashchain"
+)
+
+// IP anonymization methods.
+const (
+	AnonymizeTruncate = "truncate"
+	AnonymizeHash     = "hash"
+)
+
+// anonymizeBatch bounds how many rows one anonymization statement reads.
+const anonymizeBatch = 1000
+
+// anonymizeIP truncates an IPv4 address to its /24 and an IPv6 address to
+// its /48, or replaces it with a keyed hash that still tells visitors
+// apart. Values that do not parse are dropped.
+func (r *Repository) anonymizeIP(ip, method string) string {
+	if method == AnonymizeHash {
+		mac := hmac.New(sha256.New, r.ipKey)
+		mac.Write([]byte("anonymized-ip:" + ip))
+		return "anon:" + hex.EncodeToString(mac.Sum(nil))[:32]
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// AnonymizeIPs anonymizes the client IPs of downloads and share views
+// logged before the cutoff. It returns how many rows were changed.
+func (r *Repository) AnonymizeIPs(before time.Time, method string) (int, error) {
+	total := 0
+	for _, table := range []struct{ name, at string }{
+		{"download_logs", "downloaded_at"},
+		{"share_views", "viewed_at"},
+	} {
+		for {
+			n, err := r.anonymizeBatch(table.name, table.at, before, method)
+			if err != nil {
+				return total, err
+			}
+			total += n
+			if n < anonymizeBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (r *Repository) anonymizeBatch(table, at string, before time.Time, method string) (int, error) {
+	query := `SELECT id, COALESCE(ip_address, '') FROM ` + table + `
+		WHERE ` + at + ` < $1 AND ip_anonymized_at IS NULL
+		LIMIT $2`
+	rows, err := r.db.Query(query, before, anonymizeBatch)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to list IPs to anonymize", err)
+	}
+	type row struct {
+		id uuid.UUID
+		ip string
+	}
+	var batch []row
+	for rows.Next() {
+		var rw row
+		if err := rows.Scan(&rw.id, &rw.ip); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(500, "failed to scan IP to anonymize", err)
+		}
+		batch = append(batch, rw)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, rw := range batch {
+		ip := ""
+		if rw.ip != "" {
+			ip = r.anonymizeIP(rw.ip, method)
+		}
+		// The visitor hash goes too; it would still link the row to the
+		// address it was computed from.
+		query := `UPDATE ` + table + ` SET ip_address = $1, ip_hash = NULL, ip_anonymized_at = $2 WHERE id = $3`
+		if _, err := r.db.Exec(query, ip, now, rw.id); err != nil {
+			return 0, errors.Wrap(500, "failed to anonymize IP", err)
+		}
+	}
+	return len(batch), nil
+}
+
+// PruneDownloads deletes downloads logged before the cutoff, first adding
+// them to the daily counts when aggregate is set. It returns how many rows
+// were removed.
+//
+// Only a prefix of the hash chain is removed, and the chain is
+// checkpointed at its new start so verification still passes. The latest
+// download is always kept so the chain can continue from it.
+func (r *Repository) PruneDownloads(before time.Time, aggregate bool) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to prune downloads", err)
+	}
+	defer tx.Rollback()
+
+	if err := hashchain.Lock(tx, DownloadChain); err != nil {
+		return 0, errors.Wrap(500, "failed to lock download chain", err)
+	}
+	head, err := hashchain.Head(tx, "download_logs")
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to read download chain", err)
+	}
+	if head == nil {
+		return 0, nil
+	}
+
+	// The last row to remove is the one before the first row that is kept.
+	var last int64
+	query := `SELECT COALESCE(MIN(seq), $2) - 1 FROM download_logs WHERE seq IS NOT NULL AND downloaded_at >= $1`
+	if err := tx.QueryRow(query, before, head.Seq).Scan(&last); err != nil {
+		return 0, errors.Wrap(500, "failed to find downloads to prune", err)
+	}
+	boundary := &hashchain.Link{}
+	err = tx.QueryRow(`SELECT seq, prev_hash, hash FROM download_logs WHERE seq = $1`, last).
+		Scan(&boundary.Seq, &boundary.PrevHash, &boundary.Hash)
+	if err == sql.ErrNoRows {
+		// Nothing to remove, or this prefix was already pruned.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to read download chain", err)
+	}
+
+	if aggregate {
+		// Counts for deleted files would have nothing to reference.
+		query := `
+			INSERT INTO download_daily_counts (file_id, day, downloads)
+			SELECT d.file_id, d.downloaded_at::date, COUNT(*)
+			FROM download_logs d
+			JOIN files f ON f.id = d.file_id
+			WHERE d.seq <= $1 AND d.downloaded_at IS NOT NULL
+			GROUP BY d.file_id, d.downloaded_at::date
+			ON CONFLICT (file_id, day) DO UPDATE SET downloads = download_daily_counts.downloads + EXCLUDED.downloads
+		`
+		if _, err := tx.Exec(query, last); err != nil {
+			return 0, errors.Wrap(500, "failed to aggregate downloads", err)
+		}
+	}
+
+	if err := hashchain.SaveCheckpoint(tx, DownloadChain, boundary, time.Now()); err != nil {
+		return 0, errors.Wrap(500, "failed to checkpoint download chain", err)
+	}
+	result, err := tx.Exec(`DELETE FROM download_logs WHERE seq <= $1`, last)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to prune downloads", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(500, "failed to prune downloads", err)
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,172 @@
+package files
+
+import (
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// ArchiveEntry is a file reachable through a share together with its path
+// relative to the shared folder, used to build ZIP downloads.
+type ArchiveEntry struct {
+	Path string
+	File *File
+}
+
+const fileColumns = `f.id, f.user_id, f.org_id, f.file_content_id, f.folder_id, f.name, f.mime_type, f.is_public,
+		       fc.size, f.created_at, f.updated_at`
+
+func scanFile(row rowScanner, extra ...interface{}) (*File, error) {
+	file := &File{}
+	dest := []interface{}{
+		&file.ID, &file.UserID, &file.OrgID, &file.FileContentID, &file.FolderID, &file.Name,
+		&file.MimeType, &file.IsPublic, &file.Size, &file.CreatedAt, &file.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r *Repository) queryFiles(query string, args ...interface{}) ([]*File, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list files", err)
+	}
+	defer rows.Close()
+
+	files := []*File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan file", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ListShareItems returns the files of a collection share that have not
+// been taken down.
+func (r *Repository) ListShareItems(shareID uuid.UUID) ([]*File, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM share_items si
+		JOIN files f ON f.id = si.file_id
+		JOIN file_contents fc ON f.file_content_id = fc.id
+		WHERE si.share_id = $1 AND ` + notTakenDown + `
+		ORDER BY f.name
+	`
+	return r.queryFiles(query, shareID)
+}
+
+// ListFolderFiles returns the files directly inside a folder that have not
+// been taken down.
+func (r *Repository) ListFolderFiles(folderID uuid.UUID) ([]*File, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files f
+		JOIN file_contents fc ON f.file_content_id = fc.id
+		WHERE f.folder_id = $1 AND ` + notTakenDown + `
+		ORDER BY f.name
+	`
+	return r.queryFiles(query, folderID)
+}
+
+// FolderInSubtree reports whether folderID is rootID or one of its
+// descendants.
+func (r *Repository) FolderInSubtree(rootID, folderID uuid.UUID) (bool, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $2
+			UNION ALL
+			SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)
+	`
+	var inside bool
+	if err := r.db.QueryRow(query, rootID, folderID).Scan(&inside); err != nil {
+		return false, errors.Wrap(500, "failed to resolve folder", err)
+	}
+	return inside, nil
+}
+
+// ShareContainsFile reports whether a file is reachable through a share.
+func (r *Repository) ShareContainsFile(share *FileShare, file *File) (bool, error) {
+	switch share.TargetType {
+	case ShareTargetFile:
+		return share.FileID != nil && *share.FileID == file.ID, nil
+	case ShareTargetFolder:
+		if file.FolderID == nil || share.FolderID == nil {
+			return false, nil
+		}
+		return r.FolderInSubtree(*share.FolderID, *file.FolderID)
+	case ShareTargetCollection:
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM share_items WHERE share_id = $1 AND file_id = $2)`
+		if err := r.db.QueryRow(query, share.ID, file.ID).Scan(&exists); err != nil {
+			return false, errors.Wrap(500, "failed to check share item", err)
+		}
+		return exists, nil
+	}
+	return false, nil
+}
+
+// ListShareArchiveEntries returns every file reachable through a share,
+// leaving out files that have been taken down. Files of a folder share
+// carry their path below the shared folder.
+func (r *Repository) ListShareArchiveEntries(share *FileShare) ([]ArchiveEntry, error) {
+	var files []*File
+	var paths []string
+
+	switch share.TargetType {
+	case ShareTargetFile:
+		file, err := r.GetFileByID(*share.FileID)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.EnsureAvailable(file.ID); err != nil {
+			return nil, err
+		}
+		files, paths = []*File{file}, []string{""}
+	case ShareTargetCollection:
+		items, err := r.ListShareItems(share.ID)
+		if err != nil {
+			return nil, err
+		}
+		files, paths = items, make([]string, len(items))
+	case ShareTargetFolder:
+		query := `
+			WITH RECURSIVE tree AS (
+				SELECT id, ''::text AS path FROM folders WHERE id = $1
+				UNION ALL
+				SELECT c.id, tree.path || c.name || '/' FROM folders c JOIN tree ON c.parent_id = tree.id
+			)
+			SELECT ` + fileColumns + `, tree.path
+			FROM tree
+			JOIN files f ON f.folder_id = tree.id
+			JOIN file_contents fc ON f.file_content_id = fc.id
+			WHERE ` + notTakenDown + `
+			ORDER BY tree.path, f.name
+		`
+		rows, err := r.db.Query(query, *share.FolderID)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to list shared folder", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var path string
+			file, err := scanFile(rows, &path)
+			if err != nil {
+				return nil, errors.Wrap(500, "failed to scan file", err)
+			}
+			files = append(files, file)
+			paths = append(paths, path)
+		}
+	}
+
+	entries := make([]ArchiveEntry, len(files))
+	for i, file := range files {
+		entries[i] = ArchiveEntry{Path: paths[i] + file.Name, File: file}
+	}
+	return entries, nil
+}
@@ -0,0 +1,226 @@
+package files
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Takedown scopes: one files row, or every file with the same content.
+const (
+	TakedownScopeFile    = "file"
+	TakedownScopeContent = "content"
+)
+
+var (
+	// ErrUnavailableForLegalReasons is returned for content that has been
+	// taken down.
+	ErrUnavailableForLegalReasons = errors.New(451, "unavailable for legal reasons")
+	ErrAlreadyTakenDown           = errors.New(409, "an active takedown already covers this target")
+	ErrTakedownLifted             = errors.New(409, "takedown already lifted")
+)
+
+// notTakenDown filters out files under an active takedown in queries over
+// files f joined to file_contents fc.
+const notTakenDown = `NOT EXISTS (
+	SELECT 1 FROM takedowns t
+	WHERE t.lifted_at IS NULL
+	  AND ((t.scope = 'file' AND t.file_id = f.id) OR (t.scope = 'content' AND t.sha256_hash = fc.sha256_hash))
+)`
+
+// Takedown disables a file, or all copies of some content, until it is
+// lifted. Content takedowns also refuse new uploads of that content.
+type Takedown struct {
+	ID         uuid.UUID  `json:"id"`
+	Scope      string     `json:"scope"`
+	FileID     *uuid.UUID `json:"file_id,omitempty"`
+	SHA256Hash string     `json:"sha256_hash"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"` // active or lifted
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LiftedBy   *uuid.UUID `json:"lifted_by,omitempty"`
+	LiftedAt   *time.Time `json:"lifted_at,omitempty"`
+	LiftReason string     `json:"lift_reason,omitempty"`
+}
+
+// CreateTakedownRequest names either a file or a content hash. With a file
+// and scope "content", every file with that file's content is taken down.
+type CreateTakedownRequest struct {
+	FileID     *uuid.UUID `json:"file_id"`
+	SHA256Hash string     `json:"sha256_hash"`
+	Scope      string     `json:"scope"`
+	Reason     string     `json:"reason" binding:"required,max=2000"`
+}
+
+type LiftTakedownRequest struct {
+	Reason string `json:"reason" binding:"max=2000"`
+}
+
+const takedownColumns = `id, scope, file_id, sha256_hash, reason, created_by, created_at, lifted_by, lifted_at, lift_reason`
+
+func scanTakedown(row rowScanner) (*Takedown, error) {
+	t := &Takedown{}
+	var fileID, createdBy, liftedBy uuid.NullUUID
+	var liftedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Scope, &fileID, &t.SHA256Hash, &t.Reason, &createdBy, &t.CreatedAt,
+		&liftedBy, &liftedAt, &t.LiftReason)
+	if err != nil {
+		return nil, err
+	}
+	if fileID.Valid {
+		t.FileID = &fileID.UUID
+	}
+	if createdBy.Valid {
+		t.CreatedBy = &createdBy.UUID
+	}
+	if liftedBy.Valid {
+		t.LiftedBy = &liftedBy.UUID
+	}
+	t.Status = "active"
+	if liftedAt.Valid {
+		t.LiftedAt = &liftedAt.Time
+		t.Status = "lifted"
+	}
+	return t, nil
+}
+
+// CreateTakedown stores t, failing with ErrAlreadyTakenDown if an active
+// takedown of the same scope already covers its target.
+func (r *Repository) CreateTakedown(t *Takedown) error {
+	query := `
+		INSERT INTO takedowns (id, scope, file_id, sha256_hash, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := r.db.Exec(query, t.ID, t.Scope, t.FileID, t.SHA256Hash, t.Reason, t.CreatedBy, t.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create takedown", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAlreadyTakenDown
+	}
+	return nil
+}
+
+func (r *Repository) GetTakedown(id uuid.UUID) (*Takedown, error) {
+	t, err := scanTakedown(r.db.QueryRow(`SELECT `+takedownColumns+` FROM takedowns WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get takedown", err)
+	}
+	return t, nil
+}
+
+// ListTakedowns returns takedowns newest first, optionally only those with
+// status "active" or "lifted".
+func (r *Repository) ListTakedowns(status string) ([]*Takedown, error) {
+	query := `SELECT ` + takedownColumns + ` FROM takedowns`
+	switch status {
+	case "active":
+		query += ` WHERE lifted_at IS NULL`
+	case "lifted":
+		query += ` WHERE lifted_at IS NOT NULL`
+	}
+	query += ` ORDER BY created_at DESC LIMIT 500`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list takedowns", err)
+	}
+	defer rows.Close()
+
+	takedowns := []*Takedown{}
+	for rows.Next() {
+		t, err := scanTakedown(rows)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan takedown", err)
+		}
+		takedowns = append(takedowns, t)
+	}
+	return takedowns, nil
+}
+
+// LiftTakedown makes the target available again.
+func (r *Repository) LiftTakedown(id, liftedBy uuid.UUID, reason string) error {
+	query := `UPDATE takedowns SET lifted_at = $1, lifted_by = $2, lift_reason = $3 WHERE id = $4 AND lifted_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), liftedBy, reason, id)
+	if err != nil {
+		return errors.Wrap(500, "failed to lift takedown", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		if _, err := r.GetTakedown(id); err != nil {
+			return err
+		}
+		return ErrTakedownLifted
+	}
+	return nil
+}
+
+// ActiveTakedown returns the active takedown covering a file, either
+// directly or through its content, or nil if the file is available.
+func (r *Repository) ActiveTakedown(fileID uuid.UUID) (*Takedown, error) {
+	query := `
+		SELECT t.id, t.scope, t.file_id, t.sha256_hash, t.reason, t.created_by, t.created_at, t.lifted_by, t.lifted_at, t.lift_reason
+		FROM takedowns t
+		JOIN files f ON f.id = $1
+		JOIN file_contents fc ON fc.id = f.file_content_id
+		WHERE t.lifted_at IS NULL
+		  AND ((t.scope = 'file' AND t.file_id = f.id) OR (t.scope = 'content' AND t.sha256_hash = fc.sha256_hash))
+		ORDER BY t.created_at
+		LIMIT 1
+	`
+	t, err := scanTakedown(r.db.QueryRow(query, fileID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to check takedowns", err)
+	}
+	return t, nil
+}
+
+// EnsureAvailable fails with ErrUnavailableForLegalReasons if the file has
+// been taken down.
+func (r *Repository) EnsureAvailable(fileID uuid.UUID) error {
+	t, err := r.ActiveTakedown(fileID)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		return ErrUnavailableForLegalReasons
+	}
+	return nil
+}
+
+// ContentBlocked reports whether uploads of this content are refused.
+func (r *Repository) ContentBlocked(sha256Hash string) (bool, error) {
+	var blocked bool
+	query := `SELECT EXISTS (SELECT 1 FROM takedowns WHERE scope = 'content' AND sha256_hash = $1 AND lifted_at IS NULL)`
+	if err := r.db.QueryRow(query, sha256Hash).Scan(&blocked); err != nil {
+		return false, errors.Wrap(500, "failed to check takedowns", err)
+	}
+	return blocked, nil
+}
+
+// CountContentFiles returns how many files reference the content.
+func (r *Repository) CountContentFiles(sha256Hash string) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM files f JOIN file_contents fc ON fc.id = f.file_content_id WHERE fc.sha256_hash = $1`
+	if err := r.db.QueryRow(query, sha256Hash).Scan(&n); err != nil {
+		return 0, errors.Wrap(500, "failed to count files", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,206 @@
+// Package integrity proves the audit and download logs have not been
+// edited. Both logs are hash chains; their heads are checkpointed
+// periodically, and each chain can be verified end to end.
+package integrity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/hashchain"
+	"github.com/samridh-111/balkan_task/internal/pkg/logger"
+)
+
+// Chains lists the verifiable logs.
+var Chains = []string{audit.Chain, files.DownloadChain}
+
+var ErrUnknownChain = errors.New(400, "chain must be audit or downloads")
+
+// IsChain reports whether chain names a verifiable log.
+func IsChain(chain string) bool {
+	for _, c := range Chains {
+		if c == chain {
+			return true
+		}
+	}
+	return false
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) SaveCheckpoint(chain string, head *hashchain.Link, now time.Time) error {
+	if err := hashchain.SaveCheckpoint(r.db, chain, head, now); err != nil {
+		return errors.Wrap(500, "failed to save checkpoint", err)
+	}
+	return nil
+}
+
+// ListCheckpoints returns a chain's checkpoints, oldest first.
+func (r *Repository) ListCheckpoints(chain string) ([]hashchain.Checkpoint, error) {
+	rows, err := r.db.Query(`SELECT seq, hash, created_at FROM log_checkpoints WHERE chain = $1 ORDER BY seq`, chain)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list checkpoints", err)
+	}
+	defer rows.Close()
+
+	checkpoints := []hashchain.Checkpoint{}
+	for rows.Next() {
+		var cp hashchain.Checkpoint
+		if err := rows.Scan(&cp.Seq, &cp.Hash, &cp.CreatedAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan checkpoint", err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+func (r *Repository) lastCheckpointSeq(chain string) (int64, error) {
+	var seq int64
+	err := r.db.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM log_checkpoints WHERE chain = $1`, chain).Scan(&seq)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to read checkpoints", err)
+	}
+	return seq, nil
+}
+
+// Report is the result of verifying one chain.
+type Report struct {
+	Chain      string    `json:"chain"`
+	VerifiedAt time.Time `json:"verified_at"`
+	Unchained  int       `json:"unchained"` // rows outside the chain
+	*hashchain.Report
+}
+
+type Service struct {
+	repo      *Repository
+	auditRepo *audit.Repository
+	fileRepo  *files.Repository
+	log       *logger.Logger
+}
+
+func NewService(repo *Repository, auditRepo *audit.Repository, fileRepo *files.Repository, log *logger.Logger) *Service {
+	return &Service{repo: repo, auditRepo: auditRepo, fileRepo: fileRepo, log: log}
+}
+
+// LinkExisting chains rows logged before the chains existed. It runs at
+// startup; afterwards every row is linked as it is written.
+func (s *Service) LinkExisting() error {
+	n, err := s.auditRepo.LinkUnchained()
+	if err != nil {
+		return err
+	}
+	m, err := s.fileRepo.LinkUnchainedDownloads()
+	if err != nil {
+		return err
+	}
+	if n > 0 || m > 0 {
+		s.log.Info("Linked %d audit events and %d downloads into their hash chains", n, m)
+	}
+	return nil
+}
+
+func (s *Service) head(chain string) (*hashchain.Link, error) {
+	switch chain {
+	case audit.Chain:
+		return s.auditRepo.ChainHead()
+	case files.DownloadChain:
+		return s.fileRepo.DownloadChainHead()
+	}
+	return nil, ErrUnknownChain
+}
+
+// Checkpoint saves the head of every chain that has grown since its last
+// checkpoint. Heads are also written to the server log, so a copy exists
+// outside the database that could be rewritten along with the chain.
+func (s *Service) Checkpoint() ([]hashchain.Checkpoint, error) {
+	now := time.Now()
+	saved := []hashchain.Checkpoint{}
+	for _, chain := range Chains {
+		head, err := s.head(chain)
+		if err != nil {
+			return nil, err
+		}
+		if head == nil {
+			continue
+		}
+		last, err := s.repo.lastCheckpointSeq(chain)
+		if err != nil {
+			return nil, err
+		}
+		if head.Seq <= last {
+			continue
+		}
+		if err := s.repo.SaveCheckpoint(chain, head, now); err != nil {
+			return nil, err
+		}
+		s.log.Info("Checkpoint %s chain: seq=%d hash=%s", chain, head.Seq, head.Hash)
+		saved = append(saved, hashchain.Checkpoint{Seq: head.Seq, Hash: head.Hash, CreatedAt: now})
+	}
+	return saved, nil
+}
+
+// ListCheckpoints returns a chain's checkpoints, oldest first.
+func (s *Service) ListCheckpoints(chain string) ([]hashchain.Checkpoint, error) {
+	if !IsChain(chain) {
+		return nil, ErrUnknownChain
+	}
+	return s.repo.ListCheckpoints(chain)
+}
+
+// Start checkpoints the chains every interval in the background.
+func (s *Service) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if _, err := s.Checkpoint(); err != nil {
+				s.log.Error("Failed to checkpoint log chains: %v", err)
+			}
+		}
+	}()
+}
+
+// Verify recomputes every hash in a chain and checks it against its
+// neighbours and checkpoints, reporting modified, deleted, inserted and
+// reordered rows.
+func (s *Service) Verify(chain string) (*Report, error) {
+	var each func(func(hashchain.Record) error) error
+	var countUnchained func() (int, error)
+	switch chain {
+	case audit.Chain:
+		each, countUnchained = s.auditRepo.EachLinked, s.auditRepo.CountUnchained
+	case files.DownloadChain:
+		each, countUnchained = s.fileRepo.EachLinkedDownload, s.fileRepo.CountUnchainedDownloads
+	default:
+		return nil, ErrUnknownChain
+	}
+
+	checkpoints, err := s.repo.ListCheckpoints(chain)
+	if err != nil {
+		return nil, err
+	}
+	verifier := hashchain.NewVerifier(checkpoints)
+	if err := each(func(r hashchain.Record) error {
+		verifier.Add(r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Chain: chain, VerifiedAt: time.Now(), Report: verifier.Finish()}
+	if report.Unchained, err = countUnchained(); err != nil {
+		return nil, err
+	}
+	if report.Unchained > 0 {
+		report.Valid = false
+	}
+	return report, nil
+}
@@ -0,0 +1,261 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Enrollment is a user's TOTP registration.
+type Enrollment struct {
+	UserID          uuid.UUID
+	SecretEncrypted string
+	EnabledAt       *time.Time
+	LastUsedStep    int64
+	FailedAttempts  int
+	LockedUntil     *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Enabled reports whether the enrollment was confirmed with a valid code.
+func (e *Enrollment) Enabled() bool {
+	return e.EnabledAt != nil
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) GetEnrollment(userID uuid.UUID) (*Enrollment, error) {
+	query := `
+		SELECT user_id, secret_encrypted, enabled_at, last_used_step, failed_attempts, locked_until, created_at, updated_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+	e := &Enrollment{}
+	var enabledAt, lockedUntil sql.NullTime
+	err := r.db.QueryRow(query, userID).Scan(
+		&e.UserID, &e.SecretEncrypted, &enabledAt, &e.LastUsedStep, &e.FailedAttempts,
+		&lockedUntil, &e.CreatedAt, &e.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get mfa enrollment", err)
+	}
+	if enabledAt.Valid {
+		e.EnabledAt = &enabledAt.Time
+	}
+	if lockedUntil.Valid {
+		e.LockedUntil = &lockedUntil.Time
+	}
+	return e, nil
+}
+
+// SavePendingEnrollment stores a new, unconfirmed secret, replacing any
+// earlier unconfirmed one.
+func (r *Repository) SavePendingEnrollment(userID uuid.UUID, secretEncrypted string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret_encrypted, created_at, updated_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, enabled_at = NULL, last_used_step = 0,
+			failed_attempts = 0, locked_until = NULL, updated_at = EXCLUDED.updated_at
+		WHERE user_mfa.enabled_at IS NULL
+	`
+	if _, err := r.db.Exec(query, userID, secretEncrypted, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to save mfa enrollment", err)
+	}
+	return nil
+}
+
+// Enable confirms an enrollment and replaces the user's recovery codes.
+func (r *Repository) Enable(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE user_mfa SET enabled_at = $2, last_used_step = $3, failed_attempts = 0, locked_until = NULL, updated_at = $2
+		WHERE user_id = $1
+	`, userID, now, step)
+	if err != nil {
+		return errors.Wrap(500, "failed to enable mfa", err)
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+func (r *Repository) Delete(userID uuid.UUID) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return errors.Wrap(500, "failed to delete recovery codes", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return errors.Wrap(500, "failed to delete mfa enrollment", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+// RecordSuccess stores the time step of an accepted code. It returns false
+// if that step (or a later one) was already used, so a code observed by an
+// attacker cannot be replayed within its validity window.
+func (r *Repository) RecordSuccess(userID uuid.UUID, step int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE user_mfa SET last_used_step = $2, failed_attempts = 0, locked_until = NULL, updated_at = $3
+		WHERE user_id = $1 AND last_used_step < $2
+	`, userID, step, time.Now())
+	if err != nil {
+		return false, errors.Wrap(500, "failed to record mfa use", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(500, "failed to get rows affected", err)
+	}
+	return n == 1, nil
+}
+
+// RecordFailure counts a wrong code and locks verification for lockout
+// once maxAttempts consecutive failures are reached.
+func (r *Repository) RecordFailure(userID uuid.UUID, maxAttempts int, lockout time.Duration) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		UPDATE user_mfa
+		SET failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END,
+			updated_at = $4
+		WHERE user_id = $1
+	`, userID, maxAttempts, now.Add(lockout), now)
+	if err != nil {
+		return errors.Wrap(500, "failed to record mfa failure", err)
+	}
+	return nil
+}
+
+func (r *Repository) ReplaceRecoveryCodes(userID uuid.UUID, hashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, hashes, time.Now()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID uuid.UUID, hashes []string, now time.Time) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return errors.Wrap(500, "failed to delete recovery codes", err)
+	}
+	for _, hash := range hashes {
+		_, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)
+		`, uuid.New(), userID, hash, now)
+		if err != nil {
+			return errors.Wrap(500, "failed to create recovery code", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused code as used. It reports whether
+// a code was consumed.
+func (r *Repository) UseRecoveryCode(userID uuid.UUID, hash string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hash, time.Now())
+	if err != nil {
+		return false, errors.Wrap(500, "failed to use recovery code", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(500, "failed to get rows affected", err)
+	}
+	return n > 0, nil
+}
+
+func (r *Repository) CountUnusedRecoveryCodes(userID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(500, "failed to count recovery codes", err)
+	}
+	return count, nil
+}
+
+// recoveryAlphabet omits characters that are easy to misread.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n codes formatted as "xxxxx-xxxxx".
+func GenerateRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		var sb strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryAlphabet[randomIndex(len(recoveryAlphabet))])
+		}
+		codes[i] = sb.String()
+	}
+	return codes
+}
+
+// randomIndex returns a uniform random number in [0, n) for n <= 256.
+func randomIndex(n int) int {
+	limit := 256 - 256%n
+	b := make([]byte, 1)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic("mfa: crypto/rand failed: " + err.Error())
+		}
+		if int(b[0]) < limit {
+			return int(b[0]) % n
+		}
+	}
+}
+
+// NormalizeRecoveryCode makes entry forgiving of case, spaces and dashes.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,111 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// The RFC 6238 appendix B seed for HMAC-SHA1, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B vectors for SHA1. The RFC lists 8-digit codes; a
+// 6-digit code is their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateRFC6238(t *testing.T) {
+	key, err := b32.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range rfcVectors {
+		step := v.unix / int64(Period.Seconds())
+		if got := generate(key, step); got != v.code {
+			t.Errorf("generate at T=%d: got %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		step, ok := Validate(rfcSecret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok {
+			t.Errorf("Validate at T=%d rejected %s", v.unix, v.code)
+			continue
+		}
+		if want := v.unix / int64(Period.Seconds()); step != want {
+			t.Errorf("Validate at T=%d: step %d, want %d", v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	const code = "050471"
+	codeStep := int64(1111111111) / int64(Period.Seconds())
+	period := int64(Period.Seconds())
+
+	tests := []struct {
+		name   string
+		offset int64 // steps between the code's step and the check
+		ok     bool
+	}{
+		{"same step", 0, true},
+		{"one step late", 1, true},
+		{"one step early", -1, true},
+		{"two steps late", 2, false},
+		{"two steps early", -2, false},
+	}
+	for _, tt := range tests {
+		at := time.Unix((codeStep+tt.offset)*period, 0)
+		step, ok := Validate(rfcSecret, code, at, 0)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && step != codeStep {
+			t.Errorf("%s: step %d, want %d", tt.name, step, codeStep)
+		}
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	const code = "050471"
+	at := time.Unix(1111111111, 0)
+
+	step, ok := Validate(rfcSecret, code, at, 0)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, at, step); ok {
+		t.Error("code accepted again after its step was used")
+	}
+	if _, ok := Validate(rfcSecret, code, at.Add(Period), step); ok {
+		t.Error("code replayed in the next step's skew window")
+	}
+	if _, ok := Validate(rfcSecret, code, at, step+1); ok {
+		t.Error("code accepted after a later step was used")
+	}
+	if _, ok := Validate(rfcSecret, code, at, step-1); !ok {
+		t.Error("code rejected when only an earlier step was used")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "05047", "0504710", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, at, 0); ok {
+			t.Errorf("accepted malformed code %q", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "050471", at, 0); ok {
+		t.Error("accepted a code for an undecodable secret")
+	}
+}
@@ -0,0 +1,431 @@
+// Package orgs implements organizations: groups of users that own files
+// and folders together and share one storage quota.
+package orgs
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/db/postgres"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// Member roles, from most to least privileged. Owners manage everything
+// including other owners; admins manage members and any org file; members
+// read, upload and manage what they uploaded.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// DefaultStorageQuota is the quota of a new organization (10 GB).
+const DefaultStorageQuota int64 = 10737418240
+
+var (
+	ErrNotMember            = errors.New(403, "not a member of this organization")
+	ErrMemberExists         = errors.New(409, "user is already a member")
+	ErrLastOwner            = errors.New(409, "an organization needs at least one owner")
+	ErrOrgNotEmpty          = errors.New(409, "organization still owns files")
+	ErrOrgHeld              = errors.New(423, "organization has folders under legal hold or retention lock")
+	ErrStorageQuotaExceeded = errors.New(403, "organization storage quota exceeded")
+)
+
+var roleRank = map[string]int{RoleMember: 1, RoleAdmin: 2, RoleOwner: 3}
+
+// ValidRole reports whether role is a member role.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+type Organization struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	StorageQuota int64     `json:"storage_quota"`
+	StorageUsed  int64     `json:"storage_used"`
+	CreatedBy    uuid.UUID `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Role is the requesting user's role, set when listing their orgs.
+	Role string `json:"role,omitempty"`
+}
+
+type Member struct {
+	OrgID     uuid.UUID `json:"org_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AtLeast reports whether the member's role is role or a more privileged
+// one.
+func (m *Member) AtLeast(role string) bool {
+	return roleRank[m.Role] >= roleRank[role]
+}
+
+// OrgStats summarizes an organization for the admin dashboard.
+type OrgStats struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Members      int       `json:"members"`
+	Files        int       `json:"files"`
+	LogicalBytes int64     `json:"logical_bytes"` // sum of file sizes, before deduplication
+	StorageUsed  int64     `json:"storage_used"`
+	StorageQuota int64     `json:"storage_quota"`
+}
+
+type CreateOrgRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type UpdateOrgRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type UpdateQuotaRequest struct {
+	StorageQuota int64 `json:"storage_quota" binding:"min=0"`
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const orgColumns = `id, name, storage_quota, storage_used, created_by, created_at, updated_at`
+
+func scanOrg(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Organization, error) {
+	org := &Organization{}
+	var createdBy uuid.NullUUID
+	dest := append([]interface{}{&org.ID, &org.Name, &org.StorageQuota, &org.StorageUsed,
+		&createdBy, &org.CreatedAt, &org.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	org.CreatedBy = createdBy.UUID
+	return org, nil
+}
+
+// Create stores org with its creator as the first owner.
+func (r *Repository) Create(org *Organization) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO organizations (id, name, storage_quota, storage_used, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.Exec(query, org.ID, org.Name, org.StorageQuota, org.StorageUsed, org.CreatedBy, org.CreatedAt, org.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create organization", err)
+	}
+
+	query = `INSERT INTO organization_members (org_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, org.ID, org.CreatedBy, RoleOwner, org.CreatedAt); err != nil {
+		return errors.Wrap(500, "failed to add organization owner", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit organization", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetByID(id uuid.UUID) (*Organization, error) {
+	query := `SELECT ` + orgColumns + ` FROM organizations WHERE id = $1`
+	org, err := scanOrg(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get organization", err)
+	}
+	return org, nil
+}
+
+// ListForUser returns the organizations userID belongs to, with their role.
+func (r *Repository) ListForUser(userID uuid.UUID) ([]*Organization, error) {
+	query := `
+		SELECT o.id, o.name, o.storage_quota, o.storage_used, o.created_by, o.created_at, o.updated_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list organizations", err)
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		var role string
+		org, err := scanOrg(rows, &role)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to scan organization", err)
+		}
+		org.Role = role
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+func (r *Repository) Rename(id uuid.UUID, name string) error {
+	query := `UPDATE organizations SET name = $1, updated_at = $2 WHERE id = $3`
+	if _, err := r.db.Exec(query, name, time.Now(), id); err != nil {
+		return errors.Wrap(500, "failed to update organization", err)
+	}
+	return nil
+}
+
+func (r *Repository) UpdateQuota(id uuid.UUID, quota int64) error {
+	query := `UPDATE organizations SET storage_quota = $1, updated_at = $2 WHERE id = $3`
+	result, err := r.db.Exec(query, quota, time.Now(), id)
+	if err != nil {
+		return errors.Wrap(500, "failed to update organization quota", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes an organization and its folders. Organizations that still
+// own files, or whose folders are held, cannot be deleted.
+func (r *Repository) Delete(id uuid.UUID) error {
+	var hasFiles bool
+	if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM files WHERE org_id = $1)`, id).Scan(&hasFiles); err != nil {
+		return errors.Wrap(500, "failed to check organization files", err)
+	}
+	if hasFiles {
+		return ErrOrgNotEmpty
+	}
+	var held bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM legal_holds h JOIN folders fo ON fo.id = h.folder_id
+			WHERE fo.org_id = $1 AND h.released_at IS NULL AND (h.retain_until IS NULL OR h.retain_until > $2)
+		)
+	`
+	if err := r.db.QueryRow(query, id, time.Now()).Scan(&held); err != nil {
+		return errors.Wrap(500, "failed to check organization holds", err)
+	}
+	if held {
+		return ErrOrgHeld
+	}
+	_, err := r.db.Exec(`DELETE FROM organizations WHERE id = $1`, id)
+	if postgres.IsHoldViolation(err) {
+		return ErrOrgHeld
+	}
+	if err != nil {
+		return errors.Wrap(500, "failed to delete organization", err)
+	}
+	return nil
+}
+
+// ChargeStorage adds bytes to the organization's usage, failing with
+// ErrStorageQuotaExceeded rather than going over the quota. The check and
+// the update are one statement, so concurrent uploads cannot overshoot.
+func (r *Repository) ChargeStorage(id uuid.UUID, bytes int64) error {
+	query := `
+		UPDATE organizations SET storage_used = storage_used + $1, updated_at = $2
+		WHERE id = $3 AND storage_used + $1 <= storage_quota
+	`
+	result, err := r.db.Exec(query, bytes, time.Now(), id)
+	if err != nil {
+		return errors.Wrap(500, "failed to update organization storage", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// ReleaseStorage returns bytes charged by ChargeStorage.
+func (r *Repository) ReleaseStorage(id uuid.UUID, bytes int64) error {
+	query := `UPDATE organizations SET storage_used = GREATEST(storage_used - $1, 0), updated_at = $2 WHERE id = $3`
+	if _, err := r.db.Exec(query, bytes, time.Now(), id); err != nil {
+		return errors.Wrap(500, "failed to update organization storage", err)
+	}
+	return nil
+}
+
+// GetMember returns userID's membership, or ErrNotMember.
+func (r *Repository) GetMember(orgID, userID uuid.UUID) (*Member, error) {
+	query := `
+		SELECT m.org_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND m.user_id = $2
+	`
+	m := &Member{}
+	err := r.db.QueryRow(query, orgID, userID).Scan(&m.OrgID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get organization member", err)
+	}
+	return m, nil
+}
+
+func (r *Repository) ListMembers(orgID uuid.UUID) ([]*Member, error) {
+	query := `
+		SELECT m.org_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY u.email
+	`
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list organization members", err)
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		m := &Member{}
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan organization member", err)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func (r *Repository) AddMember(m *Member) error {
+	query := `
+		INSERT INTO organization_members (org_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+	result, err := r.db.Exec(query, m.OrgID, m.UserID, m.Role, m.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to add organization member", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return ErrMemberExists
+	}
+	return nil
+}
+
+// SetMemberRole changes a member's role. Demoting the last owner fails
+// with ErrLastOwner.
+func (r *Repository) SetMemberRole(orgID, userID uuid.UUID, role string) error {
+	return r.changeMember(orgID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE organization_members SET role = $1 WHERE org_id = $2 AND user_id = $3`, role, orgID, userID)
+		return err
+	})
+}
+
+// RemoveMember takes userID out of the organization. Removing the last
+// owner fails with ErrLastOwner. Files they uploaded stay with the org.
+func (r *Repository) RemoveMember(orgID, userID uuid.UUID) error {
+	return r.changeMember(orgID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+		return err
+	})
+}
+
+// changeMember applies change and commits only if the organization still
+// has an owner afterwards. It returns ErrNotFound if userID is not a
+// member. The member rows are locked so two concurrent
+// demotions cannot both see another owner.
+func (r *Repository) changeMember(orgID, userID uuid.UUID, change func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM organization_members WHERE org_id = $1 FOR UPDATE`, orgID); err != nil {
+		return errors.Wrap(500, "failed to lock organization members", err)
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM organization_members WHERE org_id = $1 AND user_id = $2)`, orgID, userID).Scan(&exists)
+	if err != nil {
+		return errors.Wrap(500, "failed to get organization member", err)
+	}
+	if !exists {
+		return errors.ErrNotFound
+	}
+	if err := change(tx); err != nil {
+		return errors.Wrap(500, "failed to update organization member", err)
+	}
+
+	var owners int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM organization_members WHERE org_id = $1 AND role = $2`, orgID, RoleOwner).Scan(&owners); err != nil {
+		return errors.Wrap(500, "failed to count organization owners", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit organization member", err)
+	}
+	return nil
+}
+
+// Stats returns per-organization totals, largest storage first.
+func (r *Repository) Stats() ([]*OrgStats, error) {
+	query := `
+		SELECT o.id, o.name,
+		       (SELECT COUNT(*) FROM organization_members m WHERE m.org_id = o.id),
+		       COUNT(f.id), COALESCE(SUM(fc.size), 0),
+		       o.storage_used, o.storage_quota
+		FROM organizations o
+		LEFT JOIN files f ON f.org_id = o.id
+		LEFT JOIN file_contents fc ON fc.id = f.file_content_id
+		GROUP BY o.id
+		ORDER BY o.storage_used DESC, o.name
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get organization stats", err)
+	}
+	defer rows.Close()
+
+	stats := []*OrgStats{}
+	for rows.Next() {
+		s := &OrgStats{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.Members, &s.Files, &s.LogicalBytes, &s.StorageUsed, &s.StorageQuota); err != nil {
+			return nil, errors.Wrap(500, "failed to scan organization stats", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
@@ -0,0 +1,67 @@
+// Package rbac defines the roles a user can hold and the permissions each
+// role grants. Routes are guarded by permission, never by role name, so a
+// role's capabilities can change in one place.
+package rbac
+
+import "strings"
+
+// Permission is a single capability checked by RequirePermission.
+type Permission string
+
+const (
+	PermFilesRead   Permission = "files:read"
+	PermFilesWrite  Permission = "files:write"
+	PermSharesRead  Permission = "shares:read"
+	PermSharesWrite Permission = "shares:write"
+	PermOrgsRead    Permission = "orgs:read"
+	PermOrgsWrite   Permission = "orgs:write"
+	PermAdminRead   Permission = "admin:read"
+	PermAdminWrite  Permission = "admin:write"
+)
+
+// Roles stored in users.role.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var userPermissions = []Permission{
+	PermFilesRead,
+	PermFilesWrite,
+	PermSharesRead,
+	PermSharesWrite,
+	PermOrgsRead,
+	PermOrgsWrite,
+}
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:  userPermissions,
+	RoleAdmin: append(append([]Permission{}, userPermissions...), PermAdminRead, PermAdminWrite),
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants perm. Unknown roles grant
+// nothing.
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by role.
+func Permissions(role string) []Permission {
+	return append([]Permission(nil), rolePermissions[role]...)
+}
+
+// ReadOnly reports whether perm only grants reading.
+func ReadOnly(perm Permission) bool {
+	return strings.HasSuffix(string(perm), ":read")
+}
@@ -0,0 +1,94 @@
+// Package retention enforces the privacy policy on the access logs: client
+// IPs are anonymized after a while, and old downloads are deleted or
+// folded into daily counts.
+package retention
+
+import (
+	"time"
+
+	"github.com/samridh-111/balkan_task/internal/config"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/logger"
+)
+
+// runInterval is how often the policy is applied. Each run only touches
+// rows that crossed a cutoff since the last one.
+const runInterval = time.Hour
+
+// Policy is the configured retention. A zero period disables that step.
+type Policy struct {
+	DownloadRetentionDays int    `json:"download_retention_days"`
+	Mode                  string `json:"mode"` // "aggregate" or "delete"
+	IPAnonymizeAfterDays  int    `json:"ip_anonymize_after_days"`
+	IPAnonymization       string `json:"ip_anonymization"` // "truncate" or "hash"
+}
+
+// Result reports what one run changed.
+type Result struct {
+	Policy          Policy    `json:"policy"`
+	IPsAnonymized   int       `json:"ips_anonymized"`
+	DownloadsPruned int64     `json:"downloads_pruned"`
+	RanAt           time.Time `json:"ran_at"`
+}
+
+type Service struct {
+	fileRepo *files.Repository
+	policy   Policy
+	log      *logger.Logger
+}
+
+func NewService(fileRepo *files.Repository, cfg *config.LogsConfig, log *logger.Logger) *Service {
+	policy := Policy{
+		DownloadRetentionDays: cfg.DownloadRetention,
+		Mode:                  cfg.DownloadRetentionMode,
+		IPAnonymizeAfterDays:  cfg.IPAnonymizeAfter,
+		IPAnonymization:       cfg.IPAnonymization,
+	}
+	return &Service{fileRepo: fileRepo, policy: policy, log: log}
+}
+
+// Run applies the policy once. Cutoffs fall on midnight UTC so whole days
+// are removed and daily counts stay complete.
+func (s *Service) Run() (*Result, error) {
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	result := &Result{Policy: s.policy, RanAt: now}
+
+	var err error
+	if days := s.policy.IPAnonymizeAfterDays; days > 0 {
+		result.IPsAnonymized, err = s.fileRepo.AnonymizeIPs(today.AddDate(0, 0, -days), s.policy.IPAnonymization)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if days := s.policy.DownloadRetentionDays; days > 0 {
+		result.DownloadsPruned, err = s.fileRepo.PruneDownloads(today.AddDate(0, 0, -days), s.policy.Mode == "aggregate")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result.IPsAnonymized > 0 || result.DownloadsPruned > 0 {
+		s.log.Info("Retention: anonymized %d IPs, pruned %d downloads", result.IPsAnonymized, result.DownloadsPruned)
+	}
+	return result, nil
+}
+
+// Start applies the policy now and then every runInterval in the
+// background. It first hashes any IPs logged without a visitor hash.
+func (s *Service) Start() {
+	go func() {
+		if n, err := s.fileRepo.HashMissingIPs(); err != nil {
+			s.log.Error("Failed to hash logged IPs: %v", err)
+		} else if n > 0 {
+			s.log.Info("Retention: hashed %d logged IPs", n)
+		}
+		ticker := time.NewTicker(runInterval)
+		for {
+			if _, err := s.Run(); err != nil {
+				s.log.Error("Failed to apply log retention: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
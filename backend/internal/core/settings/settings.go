@@ -0,0 +1,78 @@
+// Package settings stores instance-wide options that admins change at
+// runtime, as opposed to deployment configuration read from the
+// environment.
+package settings
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+const keyMFARequiredForAdmins = "mfa.required_for_admins"
+
+type Settings struct {
+	MFARequiredForAdmins bool `json:"mfa_required_for_admins"`
+}
+
+// UpdateRequest changes only the fields that are present.
+type UpdateRequest struct {
+	MFARequiredForAdmins *bool `json:"mfa_required_for_admins"`
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Load() (*Settings, error) {
+	s := &Settings{}
+	var err error
+	if s.MFARequiredForAdmins, err = r.getBool(keyMFARequiredForAdmins); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Repository) Update(req *UpdateRequest) (*Settings, error) {
+	if req.MFARequiredForAdmins != nil {
+		if err := r.set(keyMFARequiredForAdmins, strconv.FormatBool(*req.MFARequiredForAdmins)); err != nil {
+			return nil, err
+		}
+	}
+	return r.Load()
+}
+
+// MFARequiredForAdmins reports whether admins must use a second factor.
+func (r *Repository) MFARequiredForAdmins() (bool, error) {
+	return r.getBool(keyMFARequiredForAdmins)
+}
+
+func (r *Repository) getBool(key string) (bool, error) {
+	var value string
+	err := r.db.QueryRow(`SELECT value FROM settings WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(500, "failed to get setting", err)
+	}
+	b, _ := strconv.ParseBool(value)
+	return b, nil
+}
+
+func (r *Repository) set(key, value string) error {
+	query := `
+		INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := r.db.Exec(query, key, value, time.Now()); err != nil {
+		return errors.Wrap(500, "failed to update setting", err)
+	}
+	return nil
+}
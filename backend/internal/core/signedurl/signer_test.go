@@ -0,0 +1,128 @@
+package signedurl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/config"
+)
+
+func newTestSigner(keys ...config.SigningKey) *Signer {
+	cfg := &config.Config{SignedURL: config.SignedURLConfig{Keys: keys, MaxExpiration: 3600}}
+	return NewSigner(cfg)
+}
+
+var (
+	oldKey = config.SigningKey{ID: "k1", Secret: "old-secret"}
+	newKey = config.SigningKey{ID: "k2", Secret: "new-secret"}
+)
+
+func TestVerify(t *testing.T) {
+	signer := newTestSigner(oldKey)
+	fileID := uuid.New()
+	const clientIP = "203.0.113.7"
+
+	sign := func(opts Options) url.Values {
+		return signer.Sign(fileID, opts)
+	}
+	valid := Options{ExpiresAt: time.Now().Add(time.Hour), ClientIP: clientIP, MaxBytes: 1024}
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		fileID   uuid.UUID
+		clientIP string
+		want     error
+	}{
+		{"valid", sign(valid), fileID, clientIP, nil},
+		{"unbound IP from any client", sign(Options{ExpiresAt: valid.ExpiresAt}), fileID, "198.51.100.1", nil},
+		{"other file", sign(valid), uuid.New(), clientIP, ErrInvalidSignature},
+		{"tampered expires", with(sign(valid), ParamExpires, "99999999999"), fileID, clientIP, ErrInvalidSignature},
+		{"tampered ip", with(sign(valid), ParamIP, "198.51.100.1"), fileID, "198.51.100.1", ErrInvalidSignature},
+		{"removed ip", with(sign(valid), ParamIP, ""), fileID, "198.51.100.1", ErrInvalidSignature},
+		{"tampered max_bytes", with(sign(valid), ParamMaxBytes, "1048576"), fileID, clientIP, ErrInvalidSignature},
+		{"removed max_bytes", with(sign(valid), ParamMaxBytes, ""), fileID, clientIP, ErrInvalidSignature},
+		{"tampered sig", flipSig(sign(valid)), fileID, clientIP, ErrInvalidSignature},
+		{"malformed sig", with(sign(valid), ParamSig, "not-hex"), fileID, clientIP, ErrInvalidSignature},
+		{"unknown kid", with(sign(valid), ParamKeyID, "k9"), fileID, clientIP, ErrInvalidSignature},
+		{"expired", sign(Options{ExpiresAt: time.Now().Add(-time.Minute), ClientIP: clientIP}), fileID, clientIP, ErrExpired},
+		{"other IP", sign(valid), fileID, "198.51.100.1", ErrIPMismatch},
+	}
+	for _, tt := range tests {
+		grant, err := signer.Verify(tt.fileID, tt.values, tt.clientIP)
+		if err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && grant.FileID != tt.fileID {
+			t.Errorf("%s: grant for %s, want %s", tt.name, grant.FileID, tt.fileID)
+		}
+	}
+}
+
+func TestVerifyGrant(t *testing.T) {
+	signer := newTestSigner(oldKey)
+	fileID := uuid.New()
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	grant, err := signer.Verify(fileID, signer.Sign(fileID, Options{ExpiresAt: expires, ClientIP: "203.0.113.7", MaxBytes: 1024}), "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grant.ExpiresAt.Equal(expires) || grant.ClientIP != "203.0.113.7" || grant.MaxBytes != 1024 {
+		t.Errorf("grant = %+v", grant)
+	}
+}
+
+func TestVerifyRotatedKey(t *testing.T) {
+	fileID := uuid.New()
+	opts := Options{ExpiresAt: time.Now().Add(time.Hour)}
+
+	// A URL signed before k2 was prepended still verifies with k1.
+	issued := newTestSigner(oldKey).Sign(fileID, opts)
+	rotated := newTestSigner(newKey, oldKey)
+	if _, err := rotated.Verify(fileID, issued, ""); err != nil {
+		t.Errorf("URL signed with the rotated key: %v", err)
+	}
+
+	fresh := rotated.Sign(fileID, opts)
+	if kid := fresh.Get(ParamKeyID); kid != newKey.ID {
+		t.Errorf("signed with %q, want %q", kid, newKey.ID)
+	}
+	if _, err := rotated.Verify(fileID, fresh, ""); err != nil {
+		t.Errorf("URL signed with the active key: %v", err)
+	}
+
+	// Once k1 is removed its URLs stop working.
+	if _, err := newTestSigner(newKey).Verify(fileID, issued, ""); err != ErrInvalidSignature {
+		t.Errorf("URL signed with a removed key: err = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+// with returns a copy of values with key set to value, or removed if value
+// is empty.
+func with(values url.Values, key, value string) url.Values {
+	out := url.Values{}
+	for k, v := range values {
+		out[k] = append([]string(nil), v...)
+	}
+	if value == "" {
+		out.Del(key)
+	} else {
+		out.Set(key, value)
+	}
+	return out
+}
+
+// flipSig changes the last hex digit of the signature.
+func flipSig(values url.Values) url.Values {
+	sig := []byte(values.Get(ParamSig))
+	if sig[len(sig)-1] == '0' {
+		sig[len(sig)-1] = '1'
+	} else {
+		sig[len(sig)-1] = '0'
+	}
+	return with(values, ParamSig, string(sig))
+}
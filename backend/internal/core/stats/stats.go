@@ -0,0 +1,231 @@
+// Package stats computes the instance-wide figures shown on the admin
+// dashboard.
+package stats
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/logger"
+)
+
+const (
+	// Overviews are recomputed at most this often; the totals scan every
+	// file and download log.
+	cacheTTL = time.Minute
+
+	// The daily storage snapshot is taken by the first check of each UTC
+	// day.
+	snapshotCheckInterval = time.Hour
+
+	// A user is active if they used a session within this window.
+	activeWindow = 30 * 24 * time.Hour
+
+	recentUploadsLimit = 10
+)
+
+// Overview is the admin dashboard summary. Logical bytes count every file
+// at its full size; physical bytes count each stored content once, so the
+// difference is what deduplication saves.
+type Overview struct {
+	TotalUsers     int            `json:"totalUsers"`
+	ActiveUsers    int            `json:"activeUsers"`
+	TotalFiles     int            `json:"totalFiles"`
+	TotalStorage   int64          `json:"totalStorage"` // logical bytes
+	StorageUsed    int64          `json:"storageUsed"`  // physical bytes
+	DedupSavings   int64          `json:"dedupSavings"`
+	StorageQuota   int64          `json:"storageQuota"` // sum of user quotas
+	AvgFileSize    int64          `json:"avgFileSize"`
+	UploadsToday   int            `json:"uploadsToday"`
+	DownloadsToday int            `json:"downloadsToday"`
+	TotalDownloads int            `json:"totalDownloads"`
+	RecentUploads  []RecentUpload `json:"recentUploads"`
+	GeneratedAt    time.Time      `json:"generatedAt"`
+}
+
+type RecentUpload struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	UserEmail  string    `json:"user_email"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Overview computes the dashboard figures. "Today" starts at midnight
+// server time.
+func (r *Repository) Overview(now time.Time) (*Overview, error) {
+	o := &Overview{GeneratedAt: now}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(storage_quota), 0) FROM users`).Scan(&o.TotalUsers, &o.StorageQuota)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to count users", err)
+	}
+
+	query := `SELECT COUNT(DISTINCT user_id) FROM sessions WHERE last_seen_at >= $1`
+	if err := r.db.QueryRow(query, now.Add(-activeWindow)).Scan(&o.ActiveUsers); err != nil {
+		return nil, errors.Wrap(500, "failed to count active users", err)
+	}
+
+	query = `
+		SELECT COUNT(*), COALESCE(SUM(fc.size), 0), COUNT(*) FILTER (WHERE f.created_at >= $1)
+		FROM files f
+		JOIN file_contents fc ON fc.id = f.file_content_id
+	`
+	if err := r.db.QueryRow(query, today).Scan(&o.TotalFiles, &o.TotalStorage, &o.UploadsToday); err != nil {
+		return nil, errors.Wrap(500, "failed to count files", err)
+	}
+
+	if err := r.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM file_contents`).Scan(&o.StorageUsed); err != nil {
+		return nil, errors.Wrap(500, "failed to sum stored content", err)
+	}
+
+	// Downloads removed by the retention policy live on as daily counts.
+	query = `
+		SELECT COUNT(*) + (SELECT COALESCE(SUM(downloads), 0) FROM download_daily_counts),
+		       COUNT(*) FILTER (WHERE downloaded_at >= $1)
+		FROM download_logs
+	`
+	if err := r.db.QueryRow(query, today).Scan(&o.TotalDownloads, &o.DownloadsToday); err != nil {
+		return nil, errors.Wrap(500, "failed to count downloads", err)
+	}
+
+	if o.TotalFiles > 0 {
+		o.AvgFileSize = o.TotalStorage / int64(o.TotalFiles)
+	}
+	if o.TotalStorage > o.StorageUsed {
+		o.DedupSavings = o.TotalStorage - o.StorageUsed
+	}
+
+	if o.RecentUploads, err = r.recentUploads(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (r *Repository) recentUploads() ([]RecentUpload, error) {
+	query := `
+		SELECT f.id, f.name, u.email, fc.size, f.created_at
+		FROM files f
+		JOIN users u ON u.id = f.user_id
+		JOIN file_contents fc ON fc.id = f.file_content_id
+		ORDER BY f.created_at DESC
+		LIMIT $1
+	`
+	rows, err := r.db.Query(query, recentUploadsLimit)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to list recent uploads", err)
+	}
+	defer rows.Close()
+
+	uploads := []RecentUpload{}
+	for rows.Next() {
+		var u RecentUpload
+		if err := rows.Scan(&u.ID, &u.Name, &u.UserEmail, &u.Size, &u.UploadedAt); err != nil {
+			return nil, errors.Wrap(500, "failed to scan recent upload", err)
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, nil
+}
+
+// Service caches the overview so dashboard polling does not rescan the
+// tables on every request.
+type Service struct {
+	repo *Repository
+	log  *logger.Logger
+
+	mu     sync.Mutex
+	cached *Overview
+}
+
+func NewService(repo *Repository, log *logger.Logger) *Service {
+	return &Service{repo: repo, log: log}
+}
+
+// Overview returns the cached overview, recomputing it once it is older
+// than a minute or when refresh is set. Concurrent callers wait for a
+// single recomputation.
+func (s *Service) Overview(refresh bool) (*Overview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if !refresh && s.cached != nil && now.Sub(s.cached.GeneratedAt) < cacheTTL {
+		return s.cached, nil
+	}
+	o, err := s.repo.Overview(now)
+	if err != nil {
+		return nil, err
+	}
+	s.cached = o
+	return o, nil
+}
+
+// TakeSnapshot records today's storage usage, replacing a snapshot already
+// taken today. It returns the day recorded.
+func (s *Service) TakeSnapshot() (time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return today, s.repo.TakeSnapshot(today)
+}
+
+// StartSnapshots takes the daily storage snapshot in the background,
+// starting now if today's is missing.
+func (s *Service) StartSnapshots() {
+	go func() {
+		ticker := time.NewTicker(snapshotCheckInterval)
+		for {
+			if err := s.snapshotIfDue(); err != nil {
+				s.log.Error("Failed to take storage snapshot: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Service) snapshotIfDue() error {
+	last, err := s.repo.LastSnapshotDay()
+	if err != nil {
+		return err
+	}
+	if !last.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+		return nil
+	}
+	_, err = s.TakeSnapshot()
+	return err
+}
+
+// UsageSeries returns daily storage usage for charting.
+func (s *Service) UsageSeries(q *SeriesQuery) ([]*UsageSeries, error) {
+	if !validDimension(q.Dimension) {
+		return nil, ErrInvalidDimension
+	}
+	return s.repo.UsageSeries(q)
+}
+
+// TopUsage ranks the users or MIME categories of one day's snapshot.
+func (s *Service) TopUsage(q *TopQuery) ([]*UsageEntry, time.Time, error) {
+	if q.Dimension != DimensionUser && q.Dimension != DimensionMIME {
+		return nil, time.Time{}, errors.New(400, "dimension must be user or mime")
+	}
+	return s.repo.TopUsage(q)
+}
+
+func validDimension(dimension string) bool {
+	switch dimension {
+	case DimensionTotal, DimensionUser, DimensionMIME:
+		return true
+	}
+	return false
+}
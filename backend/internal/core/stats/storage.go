@@ -0,0 +1,252 @@
+package stats
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
+)
+
+// Storage snapshot dimensions. Files are attributed to the user who
+// uploaded them, including organization files.
+const (
+	DimensionTotal = "total"
+	DimensionUser  = "user"
+	DimensionMIME  = "mime"
+)
+
+// totalKey is the key of the single row in the total dimension.
+const totalKey = "all"
+
+// mimeCategory groups MIME types into the categories shown on the
+// dashboard: image, video, audio, text, document, archive and other.
+const mimeCategory = `
+	CASE
+		WHEN f.mime_type LIKE 'image/%' THEN 'image'
+		WHEN f.mime_type LIKE 'video/%' THEN 'video'
+		WHEN f.mime_type LIKE 'audio/%' THEN 'audio'
+		WHEN f.mime_type LIKE 'text/%' THEN 'text'
+		WHEN f.mime_type IN ('application/pdf', 'application/msword', 'application/rtf', 'application/vnd.ms-excel',
+		                     'application/vnd.ms-powerpoint')
+		  OR f.mime_type LIKE 'application/vnd.openxmlformats-officedocument.%'
+		  OR f.mime_type LIKE 'application/vnd.oasis.opendocument.%' THEN 'document'
+		WHEN f.mime_type IN ('application/zip', 'application/gzip', 'application/x-tar', 'application/x-gzip',
+		                     'application/x-7z-compressed', 'application/x-rar-compressed', 'application/vnd.rar',
+		                     'application/x-bzip2', 'application/x-xz') THEN 'archive'
+		ELSE 'other'
+	END`
+
+// UsagePoint is one day of storage usage. DedupRatio is logical over
+// physical bytes, or 0 when nothing is stored.
+type UsagePoint struct {
+	Day           string  `json:"day"`
+	LogicalBytes  int64   `json:"logical_bytes"`
+	PhysicalBytes int64   `json:"physical_bytes"`
+	FileCount     int     `json:"file_count"`
+	DedupRatio    float64 `json:"dedup_ratio"`
+}
+
+func (p *UsagePoint) setDedupRatio() {
+	if p.PhysicalBytes > 0 {
+		p.DedupRatio = float64(p.LogicalBytes) / float64(p.PhysicalBytes)
+	}
+}
+
+// UsageSeries is the daily usage of one user, MIME category or the total.
+type UsageSeries struct {
+	Key    string       `json:"key"`
+	Label  string       `json:"label,omitempty"` // the user's email
+	Points []UsagePoint `json:"points"`
+}
+
+// UsageEntry is one row of a top-N breakdown. Share is the fraction of
+// all logical bytes.
+type UsageEntry struct {
+	Key   string  `json:"key"`
+	Label string  `json:"label,omitempty"`
+	Share float64 `json:"share"`
+	UsagePoint
+}
+
+// SeriesQuery selects the snapshots to chart. Key picks one user or
+// category; without it the user dimension charts the Limit largest users
+// as of the last day and the MIME dimension charts every category.
+type SeriesQuery struct {
+	Dimension string
+	Key       string
+	From      time.Time
+	To        time.Time // exclusive
+	Limit     int
+}
+
+// TopQuery ranks one day's snapshot, the latest when Day is zero.
+type TopQuery struct {
+	Dimension string
+	Day       time.Time
+	By        string
+	Limit     int
+}
+
+var topColumns = map[string]string{
+	"logical_bytes":  "s.logical_bytes",
+	"physical_bytes": "s.physical_bytes",
+	"file_count":     "s.file_count",
+}
+
+var ErrInvalidDimension = errors.New(400, "dimension must be total, user or mime")
+
+// snapshotGroup aggregates files by the key expression. Each content is
+// counted once per group for physical bytes.
+func snapshotGroup(dimension, key string) string {
+	return fmt.Sprintf(`
+		INSERT INTO storage_snapshots (day, dimension, key, logical_bytes, physical_bytes, file_count)
+		SELECT $1, '%s', key, SUM(files * size), SUM(size), SUM(files)
+		FROM (
+			SELECT %s AS key, f.file_content_id, fc.size, COUNT(*) AS files
+			FROM files f
+			JOIN file_contents fc ON fc.id = f.file_content_id
+			GROUP BY 1, f.file_content_id, fc.size
+		) g
+		GROUP BY key`, dimension, key)
+}
+
+// TakeSnapshot records the storage usage for day, replacing any snapshot
+// already taken that day. The total's physical bytes are everything on
+// disk, including content no file references any more.
+func (r *Repository) TakeSnapshot(day time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to take storage snapshot", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM storage_snapshots WHERE day = $1`, day); err != nil {
+		return errors.Wrap(500, "failed to replace storage snapshot", err)
+	}
+
+	queries := []string{
+		snapshotGroup(DimensionUser, "f.user_id::text"),
+		snapshotGroup(DimensionMIME, mimeCategory),
+		`INSERT INTO storage_snapshots (day, dimension, key, logical_bytes, physical_bytes, file_count)
+		 SELECT $1, '` + DimensionTotal + `', '` + totalKey + `',
+		        (SELECT COALESCE(SUM(fc.size), 0) FROM files f JOIN file_contents fc ON fc.id = f.file_content_id),
+		        (SELECT COALESCE(SUM(size), 0) FROM file_contents),
+		        (SELECT COUNT(*) FROM files)`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, day); err != nil {
+			return errors.Wrap(500, "failed to take storage snapshot", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to take storage snapshot", err)
+	}
+	return nil
+}
+
+// LastSnapshotDay returns the day of the latest snapshot, or the zero time
+// if none was taken.
+func (r *Repository) LastSnapshotDay() (time.Time, error) {
+	var day sql.NullTime
+	if err := r.db.QueryRow(`SELECT MAX(day) FROM storage_snapshots`).Scan(&day); err != nil {
+		return time.Time{}, errors.Wrap(500, "failed to read storage snapshots", err)
+	}
+	return day.Time, nil
+}
+
+// UsageSeries returns the daily usage for the query, one series per key,
+// with days in order.
+func (r *Repository) UsageSeries(q *SeriesQuery) ([]*UsageSeries, error) {
+	keys := `SELECT key FROM storage_snapshots WHERE dimension = $1`
+	args := []interface{}{q.Dimension, q.From, q.To}
+	switch {
+	case q.Key != "":
+		args = append(args, q.Key)
+		keys = `SELECT $4::text`
+	case q.Dimension == DimensionUser:
+		args = append(args, q.Limit)
+		keys = `
+			SELECT key FROM storage_snapshots
+			WHERE dimension = $1 AND day = (SELECT MAX(day) FROM storage_snapshots WHERE dimension = $1 AND day < $3)
+			ORDER BY logical_bytes DESC, key
+			LIMIT $4`
+	}
+
+	query := `
+		SELECT s.key, COALESCE(u.email, ''), to_char(s.day, 'YYYY-MM-DD'), s.logical_bytes, s.physical_bytes, s.file_count
+		FROM storage_snapshots s
+		LEFT JOIN users u ON s.dimension = 'user' AND u.id::text = s.key
+		WHERE s.dimension = $1 AND s.day >= $2 AND s.day < $3 AND s.key IN (` + keys + `)
+		ORDER BY s.key, s.day`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to read storage usage", err)
+	}
+	defer rows.Close()
+
+	series := []*UsageSeries{}
+	for rows.Next() {
+		var key, label string
+		var p UsagePoint
+		if err := rows.Scan(&key, &label, &p.Day, &p.LogicalBytes, &p.PhysicalBytes, &p.FileCount); err != nil {
+			return nil, errors.Wrap(500, "failed to scan storage usage", err)
+		}
+		p.setDedupRatio()
+		if len(series) == 0 || series[len(series)-1].Key != key {
+			series = append(series, &UsageSeries{Key: key, Label: label, Points: []UsagePoint{}})
+		}
+		last := series[len(series)-1]
+		last.Points = append(last.Points, p)
+	}
+	return series, nil
+}
+
+// TopUsage ranks one day's users or MIME categories. It returns the day
+// ranked, which is zero when no snapshot exists.
+func (r *Repository) TopUsage(q *TopQuery) ([]*UsageEntry, time.Time, error) {
+	day := q.Day
+	if day.IsZero() {
+		var err error
+		if day, err = r.LastSnapshotDay(); err != nil {
+			return nil, day, err
+		}
+	}
+	entries := []*UsageEntry{}
+	if day.IsZero() {
+		return entries, day, nil
+	}
+
+	order, err := listing.OrderBy(topColumns, q.By, "desc", "logical_bytes", "s.key")
+	if err != nil {
+		return nil, day, err
+	}
+
+	query := `
+		SELECT s.key, COALESCE(u.email, ''), to_char(s.day, 'YYYY-MM-DD'), s.logical_bytes, s.physical_bytes, s.file_count,
+		       COALESCE(s.logical_bytes::float / NULLIF(t.logical_bytes, 0), 0)
+		FROM storage_snapshots s
+		LEFT JOIN users u ON s.dimension = 'user' AND u.id::text = s.key
+		LEFT JOIN storage_snapshots t ON t.dimension = '` + DimensionTotal + `' AND t.day = s.day
+		WHERE s.dimension = $1 AND s.day = $2
+		ORDER BY ` + order + `
+		LIMIT $3`
+	rows, err := r.db.Query(query, q.Dimension, day, q.Limit)
+	if err != nil {
+		return nil, day, errors.Wrap(500, "failed to rank storage usage", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &UsageEntry{}
+		err := rows.Scan(&e.Key, &e.Label, &e.Day, &e.LogicalBytes, &e.PhysicalBytes, &e.FileCount, &e.Share)
+		if err != nil {
+			return nil, day, errors.Wrap(500, "failed to scan storage usage", err)
+		}
+		e.setDedupRatio()
+		entries = append(entries, e)
+	}
+	return entries, day, nil
+}
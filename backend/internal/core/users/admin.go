@@ -0,0 +1,335 @@
+package users
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/samridh-111/balkan_task/internal/db/postgres"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
+)
+
+// AdminUserQuery filters the admin user listing. Search matches the email.
+type AdminUserQuery struct {
+	Search   string `form:"search"`
+	Role     string `form:"role"`
+	Sort     string `form:"sort"`
+	Order    string `form:"order"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+}
+
+// AdminUser is a user as listed to admins, with activity totals.
+type AdminUser struct {
+	User
+	FilesCount  int        `json:"files_count"`
+	Downloads   int        `json:"downloads"` // of the user's files, by anyone
+	LastLoginAt *time.Time `json:"last_login"`
+}
+
+var adminUserSorts = map[string]string{
+	"email":        "email",
+	"created_at":   "created_at",
+	"storage_used": "storage_used",
+	"files_count":  "files_count",
+	"last_login":   "COALESCE(last_login_at, '-infinity')", // never signed in sorts as oldest
+}
+
+// RecordLogin notes when the user last signed in.
+func (r *Repository) RecordLogin(userID uuid.UUID, at time.Time) error {
+	if _, err := r.db.Exec(`UPDATE users SET last_login_at = $1 WHERE id = $2`, at, userID); err != nil {
+		return errors.Wrap(500, "failed to record login", err)
+	}
+	return nil
+}
+
+// AdminList searches all users. It returns one page and the total number of
+// matches.
+func (r *Repository) AdminList(q *AdminUserQuery) ([]*AdminUser, int, error) {
+	orderBy, err := listing.OrderBy(adminUserSorts, q.Sort, q.Order, "created_at", "id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := []string{"TRUE"}
+	var args []interface{}
+	if q.Search != "" {
+		args = append(args, "%"+q.Search+"%")
+		where = append(where, fmt.Sprintf("email ILIKE $%d", len(args)))
+	}
+	if q.Role != "" {
+		args = append(args, q.Role)
+		where = append(where, fmt.Sprintf("role = $%d", len(args)))
+	}
+	filter := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE `+filter, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(500, "failed to count users", err)
+	}
+
+	args = append(args, q.PageSize, (q.Page-1)*q.PageSize)
+	query := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT %s, last_login_at,
+			       (SELECT COUNT(*) FROM files f WHERE f.user_id = u.id) AS files_count,
+			       (SELECT COUNT(*) FROM download_logs d JOIN files f ON f.id = d.file_id WHERE f.user_id = u.id) AS downloads
+			FROM users u
+			WHERE %s
+		) AS listed
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, userColumns, filter, orderBy, len(args)-1, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(500, "failed to list users", err)
+	}
+	defer rows.Close()
+
+	list := []*AdminUser{}
+	for rows.Next() {
+		u := &AdminUser{}
+		var lastLogin sql.NullTime
+		user, err := scanUser(rows, &lastLogin, &u.FilesCount, &u.Downloads)
+		if err != nil {
+			return nil, 0, errors.Wrap(500, "failed to scan user", err)
+		}
+		u.User = *user
+		if lastLogin.Valid {
+			u.LastLoginAt = &lastLogin.Time
+		}
+		list = append(list, u)
+	}
+	return list, total, nil
+}
+
+var (
+	ErrLastOrgOwner     = errors.New(409, "user is the last owner of an organization")
+	ErrUserHasHeldFiles = errors.New(423, "the user has files under legal hold or retention lock; transfer them instead")
+)
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type UpdateQuotaRequest struct {
+	StorageQuota int64 `json:"storage_quota" binding:"min=0"`
+}
+
+type SuspendRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// DeleteResult reports what happened to a deleted user's files. A purge
+// also removes stored contents no other file uses; their blobs are listed
+// in BlobPaths for the caller to delete once the transaction has committed.
+type DeleteResult struct {
+	FilesTransferred int      `json:"files_transferred"`
+	FilesPurged      int      `json:"files_purged"`
+	ContentsRemoved  int      `json:"contents_removed"`
+	BytesReclaimed   int64    `json:"bytes_reclaimed"`
+	BlobsNotRemoved  int      `json:"blobs_not_removed,omitempty"`
+	BlobPaths        []string `json:"-"`
+}
+
+func (r *Repository) UpdateRole(id uuid.UUID, role string) error {
+	return r.updateUser(`UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`, role, time.Now(), id)
+}
+
+func (r *Repository) UpdateQuota(id uuid.UUID, quota int64) error {
+	return r.updateUser(`UPDATE users SET storage_quota = $1, updated_at = $2 WHERE id = $3`, quota, time.Now(), id)
+}
+
+// Suspend blocks the user from signing in and from using existing tokens.
+func (r *Repository) Suspend(id uuid.UUID, reason string) error {
+	now := time.Now()
+	return r.updateUser(`UPDATE users SET suspended_at = $1, suspended_reason = $2, updated_at = $1 WHERE id = $3`, now, reason, id)
+}
+
+func (r *Repository) Unsuspend(id uuid.UUID) error {
+	return r.updateUser(`UPDATE users SET suspended_at = NULL, suspended_reason = '', updated_at = $1 WHERE id = $2`, time.Now(), id)
+}
+
+// IsSuspended is the per-request suspension check.
+func (r *Repository) IsSuspended(id uuid.UUID) (bool, error) {
+	var suspended bool
+	err := r.db.QueryRow(`SELECT suspended_at IS NOT NULL FROM users WHERE id = $1`, id).Scan(&suspended)
+	if err == sql.ErrNoRows {
+		return false, errors.ErrNotFound
+	}
+	if err != nil {
+		return false, errors.Wrap(500, "failed to check user status", err)
+	}
+	return suspended, nil
+}
+
+// updateUser runs an UPDATE of one user, returning ErrNotFound if there is
+// no such user.
+func (r *Repository) updateUser(query string, args ...interface{}) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return errors.Wrap(500, "failed to update user", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(500, "failed to get rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a user. Their personal files and folders go to transferTo,
+// along with the storage they were charged for, or are purged when it is
+// nil, together with stored contents no other file uses. Files they
+// uploaded to an organization stay with it and are attributed to one of its
+// owners; a user who is the last owner of an organization cannot be
+// deleted, and one with held personal files cannot be purged.
+func (r *Repository) Delete(id uuid.UUID, transferTo *uuid.UUID) (*DeleteResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	var storageUsed int64
+	err = tx.QueryRow(`SELECT storage_used FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&storageUsed)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get user", err)
+	}
+
+	var lastOwner bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members m
+			WHERE m.user_id = $1 AND m.role = 'owner'
+			  AND NOT EXISTS (
+				SELECT 1 FROM organization_members o
+				WHERE o.org_id = m.org_id AND o.role = 'owner' AND o.user_id <> $1
+			  )
+		)
+	`, id).Scan(&lastOwner)
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to check organization ownership", err)
+	}
+	if lastOwner {
+		return nil, ErrLastOrgOwner
+	}
+
+	for _, table := range []string{"files", "folders"} {
+		query := fmt.Sprintf(`
+			UPDATE %[1]s t SET user_id = (
+				SELECT m.user_id FROM organization_members m
+				WHERE m.org_id = t.org_id AND m.role = 'owner' AND m.user_id <> $1
+				ORDER BY m.created_at LIMIT 1
+			)
+			WHERE t.user_id = $1 AND t.org_id IS NOT NULL
+		`, table)
+		if _, err := tx.Exec(query, id); err != nil {
+			return nil, errors.Wrap(500, "failed to reassign organization "+table, err)
+		}
+	}
+
+	result := &DeleteResult{}
+	if transferTo != nil {
+		moved, err := tx.Exec(`UPDATE files SET user_id = $1, updated_at = $2 WHERE user_id = $3`, *transferTo, time.Now(), id)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to transfer files", err)
+		}
+		n, err := moved.RowsAffected()
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to get rows affected", err)
+		}
+		result.FilesTransferred = int(n)
+
+		if _, err := tx.Exec(`UPDATE folders SET user_id = $1, updated_at = $2 WHERE user_id = $3`, *transferTo, time.Now(), id); err != nil {
+			return nil, errors.Wrap(500, "failed to transfer folders", err)
+		}
+		query := `UPDATE users SET storage_used = storage_used + $1, updated_at = $2 WHERE id = $3`
+		if _, err := tx.Exec(query, storageUsed, time.Now(), *transferTo); err != nil {
+			return nil, errors.Wrap(500, "failed to transfer storage", err)
+		}
+	}
+
+	// Contents of purged files, to be removed once nothing uses them.
+	var contentIDs []string
+	if transferTo == nil {
+		// The database refuses to delete held files anyway; checking first
+		// gives a clearer error than the one the cascade would raise.
+		var held bool
+		query := `
+			SELECT EXISTS (SELECT 1 FROM files WHERE user_id = $1 AND file_is_held(id, folder_id))
+			    OR EXISTS (SELECT 1 FROM folders WHERE user_id = $1 AND folder_is_held(id))
+		`
+		if err := tx.QueryRow(query, id).Scan(&held); err != nil {
+			return nil, errors.Wrap(500, "failed to check holds", err)
+		}
+		if held {
+			return nil, ErrUserHasHeldFiles
+		}
+
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM files WHERE user_id = $1`, id).Scan(&result.FilesPurged); err != nil {
+			return nil, errors.Wrap(500, "failed to count files", err)
+		}
+		query = `SELECT ARRAY(SELECT DISTINCT file_content_id::text FROM files WHERE user_id = $1)`
+		if err := tx.QueryRow(query, id).Scan(pq.Array(&contentIDs)); err != nil {
+			return nil, errors.Wrap(500, "failed to list file contents", err)
+		}
+	}
+
+	// Remaining files, folders, shares, tokens and sessions cascade.
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, id); err != nil {
+		if postgres.IsHoldViolation(err) {
+			return nil, ErrUserHasHeldFiles
+		}
+		return nil, errors.Wrap(500, "failed to delete user", err)
+	}
+
+	if len(contentIDs) > 0 {
+		if err := purgeContents(tx, contentIDs, result); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(500, "failed to commit user deletion", err)
+	}
+	return result, nil
+}
+
+// purgeContents removes those of contentIDs that no file references any
+// more. Content still used by someone else's file stays.
+func purgeContents(tx *sql.Tx, contentIDs []string, result *DeleteResult) error {
+	rows, err := tx.Query(`
+		DELETE FROM file_contents fc
+		WHERE fc.id = ANY($1::uuid[]) AND NOT EXISTS (SELECT 1 FROM files f WHERE f.file_content_id = fc.id)
+		RETURNING fc.storage_path, fc.size
+	`, pq.Array(contentIDs))
+	if err != nil {
+		return errors.Wrap(500, "failed to delete file contents", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path string
+		var size int64
+		if err := rows.Scan(&path, &size); err != nil {
+			return errors.Wrap(500, "failed to scan file content", err)
+		}
+		result.ContentsRemoved++
+		result.BytesReclaimed += size
+		result.BlobPaths = append(result.BlobPaths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(500, "failed to delete file contents", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package users
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// bootstrapAdminLock is the advisory lock key that serializes bootstrap
+// admin grants, so two accounts verified at the same moment cannot both
+// be the first.
+const bootstrapAdminLock = 0x626f6f74
+
+// MarkEmailVerified records that the user has proved they own their
+// address. The bootstrap admin email, or the first address verified on a
+// fresh install, is made an admin at that point. bootstrapAdminEmail may
+// be empty.
+func (r *Repository) MarkEmailVerified(userID uuid.UUID, bootstrapAdminEmail string) error {
+	return r.withBootstrapLock(func(tx *sql.Tx) error {
+		var email string
+		query := `UPDATE users SET email_verified_at = $1, updated_at = $1 WHERE id = $2 AND email_verified_at IS NULL RETURNING email`
+		err := tx.QueryRow(query, time.Now(), userID).Scan(&email)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(500, "failed to mark email verified", err)
+		}
+		_, err = grantBootstrapAdmin(tx, userID, email, bootstrapAdminEmail)
+		return err
+	})
+}
+
+// CreateVerified creates a user whose email is already verified, such as
+// one vouched for by an identity provider, under the same bootstrap admin
+// rule as MarkEmailVerified. user.Role is updated if the user was made an
+// admin.
+func (r *Repository) CreateVerified(user *User, bootstrapAdminEmail string) error {
+	return r.withBootstrapLock(func(tx *sql.Tx) error {
+		if err := createUser(tx, user); err != nil {
+			return err
+		}
+		promoted, err := grantBootstrapAdmin(tx, user.ID, user.Email, bootstrapAdminEmail)
+		if err != nil {
+			return err
+		}
+		if promoted {
+			user.Role = rbac.RoleAdmin
+		}
+		return nil
+	})
+}
+
+func (r *Repository) withBootstrapLock(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Wrap(500, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, bootstrapAdminLock); err != nil {
+		return errors.Wrap(500, "failed to lock bootstrap admin", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(500, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+// grantBootstrapAdmin makes a just-verified user an admin when email is
+// the bootstrap admin email or no other account has a verified email yet.
+func grantBootstrapAdmin(tx *sql.Tx, userID uuid.UUID, email, bootstrapAdminEmail string) (bool, error) {
+	if bootstrapAdminEmail == "" || !strings.EqualFold(email, bootstrapAdminEmail) {
+		var first bool
+		query := `SELECT NOT EXISTS (SELECT 1 FROM users WHERE email_verified_at IS NOT NULL AND id <> $1)`
+		if err := tx.QueryRow(query, userID).Scan(&first); err != nil {
+			return false, errors.Wrap(500, "failed to check for verified users", err)
+		}
+		if !first {
+			return false, nil
+		}
+	}
+
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
+	if _, err := tx.Exec(query, rbac.RoleAdmin, time.Now(), userID); err != nil {
+		return false, errors.Wrap(500, "failed to grant bootstrap admin", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,53 @@
+package users
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+const prefixedUserColumns = `u.id, u.email, u.password_hash, u.role, u.storage_quota, u.storage_used, u.email_verified_at,
+	u.suspended_at, u.suspended_reason, u.created_at, u.updated_at`
+
+// Identity links a user to the subject of an external OpenID provider.
+type Identity struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Issuer    string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// GetByIdentity returns the user linked to subject at issuer.
+func (r *Repository) GetByIdentity(issuer, subject string) (*User, error) {
+	query := `
+		SELECT ` + prefixedUserColumns + `
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`
+	user, err := scanUser(r.db.QueryRow(query, issuer, subject))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(500, "failed to get user by identity", err)
+	}
+	return user, nil
+}
+
+func (r *Repository) CreateIdentity(identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, identity.ID, identity.UserID, identity.Issuer, identity.Subject,
+		identity.Email, identity.CreatedAt)
+	if err != nil {
+		return errors.Wrap(500, "failed to create identity", err)
+	}
+	return nil
+}
@@ -17,29 +17,53 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 func (r *Repository) Create(user *User) error {
+	return createUser(r.db, user)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createUser(db execer, user *User) error {
 	query := `
-		INSERT INTO users (id, email, password_hash, role, storage_quota, storage_used, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO users (id, email, password_hash, role, storage_quota, storage_used, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.Exec(query, user.ID, user.Email, user.PasswordHash, user.Role,
-		user.StorageQuota, user.StorageUsed, user.CreatedAt, user.UpdatedAt)
+	_, err := db.Exec(query, user.ID, user.Email, user.PasswordHash, user.Role,
+		user.StorageQuota, user.StorageUsed, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return errors.Wrap(500, "failed to create user", err)
 	}
 	return nil
 }
 
-func (r *Repository) GetByEmail(email string) (*User, error) {
-	query := `
-		SELECT id, email, password_hash, role, storage_quota, storage_used, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
+const userColumns = `id, email, password_hash, role, storage_quota, storage_used, email_verified_at,
+	suspended_at, suspended_reason, created_at, updated_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*User, error) {
 	user := &User{}
-	err := r.db.QueryRow(query, email).Scan(
+	var verifiedAt, suspendedAt sql.NullTime
+	dest := []interface{}{
 		&user.ID, &user.Email, &user.PasswordHash, &user.Role,
-		&user.StorageQuota, &user.StorageUsed, &user.CreatedAt, &user.UpdatedAt,
-	)
+		&user.StorageQuota, &user.StorageUsed, &verifiedAt,
+		&suspendedAt, &user.SuspendedReason, &user.CreatedAt, &user.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	return user, nil
+}
+
+func (r *Repository) GetByEmail(email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	user, err := scanUser(r.db.QueryRow(query, email))
 	if err == sql.ErrNoRows {
 		return nil, errors.ErrNotFound
 	}
@@ -50,16 +74,8 @@ func (r *Repository) GetByEmail(email string) (*User, error) {
 }
 
 func (r *Repository) GetByID(id uuid.UUID) (*User, error) {
-	query := `
-		SELECT id, email, password_hash, role, storage_quota, storage_used, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
-	user := &User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Role,
-		&user.StorageQuota, &user.StorageUsed, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(r.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, errors.ErrNotFound
 	}
@@ -82,3 +98,10 @@ func (r *Repository) UpdateStorageUsed(userID uuid.UUID, storageUsed int64) erro
 	return nil
 }
 
+func (r *Repository) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3`
+	if _, err := r.db.Exec(query, passwordHash, time.Now(), userID); err != nil {
+		return errors.Wrap(500, "failed to update password", err)
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS file_request_submissions;
+DROP TABLE IF EXISTS file_requests;
+ALTER TABLE files DROP COLUMN IF EXISTS folder_id;
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS share_views;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS referrer;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS ip_hash;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS share_id;
@@ -0,0 +1,22 @@
+
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS share_id UUID REFERENCES file_shares(id) ON DELETE SET NULL;
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS ip_hash VARCHAR(64);
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS referrer TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_download_logs_share_id ON download_logs(share_id);
+
+CREATE TABLE IF NOT EXISTS share_views (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    share_id UUID NOT NULL REFERENCES file_shares(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45),
+    ip_hash VARCHAR(64),
+    user_agent TEXT,
+    referrer TEXT,
+    viewed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_views_share_id ON share_views(share_id);
+CREATE INDEX IF NOT EXISTS idx_share_views_file_id ON share_views(file_id);
+CREATE INDEX IF NOT EXISTS idx_share_views_viewed_at ON share_views(viewed_at);
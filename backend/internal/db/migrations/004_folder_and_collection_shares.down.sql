@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS share_items;
+DELETE FROM share_views WHERE file_id IS NULL;
+ALTER TABLE share_views ALTER COLUMN file_id SET NOT NULL;
+DELETE FROM file_shares WHERE target_type <> 'file';
+ALTER TABLE file_shares DROP CONSTRAINT IF EXISTS file_shares_target_check;
+ALTER TABLE file_shares ALTER COLUMN file_id SET NOT NULL;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS folder_id;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS target_type;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,25 @@
+
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS target_type VARCHAR(20) DEFAULT 'file';
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS folder_id UUID REFERENCES folders(id) ON DELETE CASCADE;
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255);
+ALTER TABLE file_shares ALTER COLUMN file_id DROP NOT NULL;
+
+UPDATE file_shares s SET user_id = f.user_id FROM files f WHERE s.file_id = f.id AND s.user_id IS NULL;
+
+ALTER TABLE file_shares DROP CONSTRAINT IF EXISTS file_shares_target_check;
+ALTER TABLE file_shares ADD CONSTRAINT file_shares_target_check CHECK (
+    (target_type = 'file' AND file_id IS NOT NULL) OR
+    (target_type = 'folder' AND folder_id IS NOT NULL) OR
+    (target_type = 'collection')
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_shares_user_id ON file_shares(user_id);
+
+CREATE TABLE IF NOT EXISTS share_items (
+    share_id UUID NOT NULL REFERENCES file_shares(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    PRIMARY KEY (share_id, file_id)
+);
+
+ALTER TABLE share_views ALTER COLUMN file_id DROP NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE file_shares DROP COLUMN IF EXISTS valid_from;
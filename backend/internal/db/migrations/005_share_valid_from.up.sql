@@ -0,0 +1,4 @@
+
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_file_shares_valid_from ON file_shares(valid_from) WHERE valid_from IS NOT NULL;
@@ -0,0 +1,13 @@
+
+-- Asymmetric JWT signing keys. Private keys are stored encrypted; a key signs
+-- from not_before until the next key's not_before, and keeps verifying for a
+-- while after that.
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    private_key TEXT NOT NULL,
+    not_before TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jwt_signing_keys_algorithm_not_before ON jwt_signing_keys(algorithm, not_before);
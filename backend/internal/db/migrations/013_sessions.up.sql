@@ -0,0 +1,23 @@
+
+-- One row per login, keyed by its refresh token family
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Logins from before sessions were tracked; the client is unknown
+INSERT INTO sessions (id, user_id, device_label, created_at, last_seen_at, expires_at)
+SELECT family_id, user_id, 'Unknown device', MIN(created_at), MAX(created_at), MAX(expires_at)
+FROM refresh_tokens
+GROUP BY family_id, user_id
+HAVING BOOL_AND(revoked_at IS NULL) AND MAX(expires_at) > CURRENT_TIMESTAMP
+ON CONFLICT (id) DO NOTHING;
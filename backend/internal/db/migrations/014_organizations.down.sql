@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_folders_org_id;
+DROP INDEX IF EXISTS idx_files_org_id;
+ALTER TABLE folders DROP COLUMN IF EXISTS org_id;
+ALTER TABLE files DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,2 @@
+-- Active users on the admin dashboard are counted from recent sessions
+CREATE INDEX IF NOT EXISTS idx_sessions_last_seen_at ON sessions(last_seen_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_files_name;
+ALTER TABLE users DROP COLUMN IF EXISTS last_login_at;
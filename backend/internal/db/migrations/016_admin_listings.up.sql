@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMP;
+
+-- Seed from the sessions started before logins were recorded
+UPDATE users u
+SET last_login_at = s.last_login
+FROM (SELECT user_id, MAX(created_at) AS last_login FROM sessions GROUP BY user_id) s
+WHERE s.user_id = u.id AND u.last_login_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_files_name ON files(name);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS takedowns (
+    id UUID PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('file', 'content')),
+    file_id UUID REFERENCES files(id) ON DELETE SET NULL,
+    sha256_hash VARCHAR(64) NOT NULL,
+    reason TEXT NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lifted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    lifted_at TIMESTAMP,
+    lift_reason TEXT NOT NULL DEFAULT ''
+);
+
+-- At most one active takedown per file and per content hash
+CREATE UNIQUE INDEX IF NOT EXISTS idx_takedowns_active_file ON takedowns(file_id) WHERE scope = 'file' AND lifted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_takedowns_active_content ON takedowns(sha256_hash) WHERE scope = 'content' AND lifted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_takedowns_created_at ON takedowns(created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_events_ip_address;
+DROP INDEX IF EXISTS idx_audit_events_action;
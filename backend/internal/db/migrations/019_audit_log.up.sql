@@ -0,0 +1,3 @@
+-- Filtering the audit log by action and by client IP
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_ip_address ON audit_events(ip_address);
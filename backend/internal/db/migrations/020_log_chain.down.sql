@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS log_checkpoints;
+
+-- Rows whose user, file or share is gone would violate the restored
+-- foreign keys, so they are only enforced for new rows.
+ALTER TABLE download_logs ADD CONSTRAINT download_logs_share_id_fkey FOREIGN KEY (share_id) REFERENCES file_shares(id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE download_logs ADD CONSTRAINT download_logs_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE download_logs ADD CONSTRAINT download_logs_file_id_fkey FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE audit_events ADD CONSTRAINT audit_events_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
+
+DROP INDEX IF EXISTS idx_download_logs_seq;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS hash;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS seq;
+
+DROP INDEX IF EXISTS idx_audit_events_seq;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,28 @@
+-- Hash chains over the audit and download logs. Rows are linked by the
+-- application, which also links rows that predate these columns.
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_seq ON audit_events(seq);
+
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_download_logs_seq ON download_logs(seq);
+
+-- Chained rows must never change, so deleting a user, file or share no
+-- longer cascades into the logs; they keep the IDs as recorded.
+ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS audit_events_actor_id_fkey;
+ALTER TABLE download_logs DROP CONSTRAINT IF EXISTS download_logs_file_id_fkey;
+ALTER TABLE download_logs DROP CONSTRAINT IF EXISTS download_logs_user_id_fkey;
+ALTER TABLE download_logs DROP CONSTRAINT IF EXISTS download_logs_share_id_fkey;
+
+CREATE TABLE IF NOT EXISTS log_checkpoints (
+    id UUID PRIMARY KEY,
+    chain VARCHAR(20) NOT NULL,
+    seq BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_log_checkpoints_chain ON log_checkpoints(chain, seq);
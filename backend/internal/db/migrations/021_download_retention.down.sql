@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_download_logs_file_id_downloaded_at;
+DROP INDEX IF EXISTS idx_download_logs_user_id_downloaded_at;
+
+ALTER TABLE share_views DROP COLUMN IF EXISTS ip_anonymized_at;
+ALTER TABLE download_logs DROP COLUMN IF EXISTS ip_anonymized_at;
+
+DROP TABLE IF EXISTS download_daily_counts;
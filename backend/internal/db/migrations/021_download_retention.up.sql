@@ -0,0 +1,17 @@
+-- Downloads past the retention period are folded into daily counts per
+-- file before they are deleted.
+CREATE TABLE IF NOT EXISTS download_daily_counts (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (file_id, day)
+);
+
+-- Set once a row's client IP has been truncated or hashed. ip_address is
+-- not covered by the download log hash chain, so anonymizing it is not
+-- tampering.
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS ip_anonymized_at TIMESTAMP;
+ALTER TABLE share_views ADD COLUMN IF NOT EXISTS ip_anonymized_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_download_logs_user_id_downloaded_at ON download_logs(user_id, downloaded_at);
+CREATE INDEX IF NOT EXISTS idx_download_logs_file_id_downloaded_at ON download_logs(file_id, downloaded_at);
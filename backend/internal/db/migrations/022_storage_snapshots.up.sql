@@ -0,0 +1,11 @@
+-- Daily storage usage per user, per MIME category and in total. Physical
+-- bytes count each stored content once within the row's group.
+CREATE TABLE IF NOT EXISTS storage_snapshots (
+    day DATE NOT NULL,
+    dimension VARCHAR(10) NOT NULL,
+    key VARCHAR(64) NOT NULL,
+    logical_bytes BIGINT NOT NULL,
+    physical_bytes BIGINT NOT NULL,
+    file_count INTEGER NOT NULL,
+    PRIMARY KEY (dimension, day, key)
+);
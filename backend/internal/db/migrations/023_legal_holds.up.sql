@@ -0,0 +1,22 @@
+-- Legal holds and retention locks keep files from being deleted. A hold on
+-- a folder covers every file below it. Legal holds last until released;
+-- retention locks cannot be released and end at retain_until.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id UUID PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('legal_hold', 'retention')),
+    target_type VARCHAR(10) NOT NULL CHECK (target_type IN ('file', 'folder')),
+    file_id UUID REFERENCES files(id) ON DELETE SET NULL,
+    folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    retain_until TIMESTAMP,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    released_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP,
+    release_reason TEXT NOT NULL DEFAULT '',
+    CHECK ((kind = 'retention') = (retain_until IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_holds_file_id ON legal_holds(file_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_legal_holds_folder_id ON legal_holds(folder_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_legal_holds_created_at ON legal_holds(created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE file_shares DROP COLUMN IF EXISTS password_failed_at;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS password_failures;
@@ -0,0 +1,3 @@
+-- Wrong share passwords, counted per share to throttle guessing.
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS password_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS password_failed_at TIMESTAMP;
@@ -0,0 +1,2 @@
+-- Demoted accounts are not restored.
+DROP TABLE IF EXISTS data_migrations;
@@ -0,0 +1,25 @@
+-- Data migrations that must run exactly once, since migration files are
+-- re-applied on every start.
+CREATE TABLE IF NOT EXISTS data_migrations (
+    name VARCHAR(100) PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Registration used to make every new account an admin. Demote those
+-- accounts, keeping the oldest one (the admin a fresh install gets) and
+-- anyone an admin promoted through the admin API.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM data_migrations WHERE name = 'demote_registration_admins') THEN
+        UPDATE users u SET role = 'user', updated_at = CURRENT_TIMESTAMP
+        WHERE u.role = 'admin'
+          AND u.id <> (SELECT id FROM users ORDER BY created_at, id LIMIT 1)
+          AND NOT EXISTS (
+              SELECT 1 FROM audit_events e
+              WHERE e.action = 'admin.user.role_changed'
+                AND e.target_id = u.id::text
+                AND e.details->>'to' = 'admin'
+          );
+        INSERT INTO data_migrations (name) VALUES ('demote_registration_admins');
+    END IF;
+END $$;
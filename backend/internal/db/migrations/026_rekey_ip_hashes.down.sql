@@ -0,0 +1,4 @@
+-- Cleared hashes and the old chain links are not restored.
+DROP INDEX IF EXISTS idx_share_views_unhashed_ip;
+DROP INDEX IF EXISTS idx_download_logs_unhashed_ip;
+DELETE FROM data_migrations WHERE name = 'rekey_ip_hashes';
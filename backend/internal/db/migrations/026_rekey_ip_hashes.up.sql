@@ -0,0 +1,21 @@
+-- Visitor hashes used to be an unkeyed SHA-256 of the IP, which anyone can
+-- reverse by hashing every address, and the download hash chain covered
+-- them, so they could not be removed. Clear them once; the API re-hashes
+-- the IPs that are not anonymized yet with LOG_IP_HASH_KEY at startup.
+-- The download chain no longer covers the hash, so it is re-linked from
+-- scratch and its old checkpoints are dropped.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM data_migrations WHERE name = 'rekey_ip_hashes') THEN
+        UPDATE download_logs SET ip_hash = NULL, seq = NULL, prev_hash = NULL, hash = NULL;
+        UPDATE share_views SET ip_hash = NULL;
+        DELETE FROM log_checkpoints WHERE chain = 'downloads';
+        INSERT INTO data_migrations (name) VALUES ('rekey_ip_hashes');
+    END IF;
+END $$;
+
+-- Rows still waiting for a keyed hash.
+CREATE INDEX IF NOT EXISTS idx_download_logs_unhashed_ip ON download_logs(id)
+    WHERE ip_hash IS NULL AND ip_anonymized_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_share_views_unhashed_ip ON share_views(id)
+    WHERE ip_hash IS NULL AND ip_anonymized_at IS NULL;
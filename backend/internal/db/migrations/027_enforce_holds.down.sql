@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS folders_refuse_held_delete ON folders;
+DROP TRIGGER IF EXISTS files_refuse_held_delete ON files;
+DROP FUNCTION IF EXISTS refuse_held_folder_delete();
+DROP FUNCTION IF EXISTS refuse_held_file_delete();
+DROP FUNCTION IF EXISTS file_is_held(UUID, UUID);
+DROP FUNCTION IF EXISTS folder_is_held(UUID);
@@ -0,0 +1,56 @@
+-- Enforce legal holds and retention locks in the database, so no DELETE
+-- can remove held data, including one cascading from a deleted user or
+-- organization. Deleting a folder also fails while it or a folder above it
+-- is held, since that would move its files out from under the hold.
+
+-- folder_is_held reports whether an active hold covers the folder, on
+-- itself or on a folder above it.
+CREATE OR REPLACE FUNCTION folder_is_held(folder UUID) RETURNS BOOLEAN AS $$
+    WITH RECURSIVE up(id) AS (
+        SELECT folder
+        UNION ALL
+        SELECT p.parent_id FROM folders p JOIN up ON p.id = up.id WHERE p.parent_id IS NOT NULL
+    )
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (h.retain_until IS NULL OR h.retain_until > LOCALTIMESTAMP)
+          AND h.folder_id IN (SELECT id FROM up)
+    )
+$$ LANGUAGE SQL STABLE;
+
+-- file_is_held reports whether an active hold covers the file, directly or
+-- through the folder it is in.
+CREATE OR REPLACE FUNCTION file_is_held(file UUID, folder UUID) RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (h.retain_until IS NULL OR h.retain_until > LOCALTIMESTAMP)
+          AND h.file_id = file
+    ) OR (folder IS NOT NULL AND folder_is_held(folder))
+$$ LANGUAGE SQL STABLE;
+
+-- SQLSTATE HL423 tells the API a delete was refused because of a hold.
+CREATE OR REPLACE FUNCTION refuse_held_file_delete() RETURNS TRIGGER AS $$
+BEGIN
+    IF file_is_held(OLD.id, OLD.folder_id) THEN
+        RAISE EXCEPTION 'file % is under legal hold or retention lock', OLD.id USING ERRCODE = 'HL423';
+    END IF;
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION refuse_held_folder_delete() RETURNS TRIGGER AS $$
+BEGIN
+    IF folder_is_held(OLD.id) THEN
+        RAISE EXCEPTION 'folder % is under legal hold or retention lock', OLD.id USING ERRCODE = 'HL423';
+    END IF;
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS files_refuse_held_delete ON files;
+CREATE TRIGGER files_refuse_held_delete BEFORE DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION refuse_held_file_delete();
+
+DROP TRIGGER IF EXISTS folders_refuse_held_delete ON folders;
+CREATE TRIGGER folders_refuse_held_delete BEFORE DELETE ON folders
+    FOR EACH ROW EXECUTE FUNCTION refuse_held_folder_delete();
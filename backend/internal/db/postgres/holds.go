@@ -0,0 +1,14 @@
+package postgres
+
+import "github.com/lib/pq"
+
+// holdViolation is the SQLSTATE raised when a DELETE would remove a file or
+// folder under legal hold or retention lock (migration 027).
+const holdViolation = "HL423"
+
+// IsHoldViolation reports whether err is the database refusing to delete
+// held data.
+func IsHoldViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == holdViolation
+}
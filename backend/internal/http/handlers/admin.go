@@ -2,234 +2,268 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/core/integrity"
+	"github.com/samridh-111/balkan_task/internal/core/orgs"
+	"github.com/samridh-111/balkan_task/internal/core/retention"
+	"github.com/samridh-111/balkan_task/internal/core/settings"
+	"github.com/samridh-111/balkan_task/internal/core/stats"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
 )
 
-// AdminHandler handles admin-related HTTP requests
-type AdminHandler struct{}
+// AdminHandler handles admin-related HTTP requests. Access is enforced by
+// RequirePermission on the admin route group.
+type AdminHandler struct {
+	authService    *auth.AuthService
+	accountService *auth.AccountService
+	settingsRepo   *settings.Repository
+	attemptRepo    *auth.LoginAttemptRepository
+	orgRepo        *orgs.Repository
+	statsService   *stats.Service
+	fileRepo       *files.Repository
+	userRepo       *users.Repository
+	auditRepo      *audit.Repository
+	integrity      *integrity.Service
+	retention      *retention.Service
+}
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+func NewAdminHandler(authService *auth.AuthService, accountService *auth.AccountService, settingsRepo *settings.Repository, attemptRepo *auth.LoginAttemptRepository, orgRepo *orgs.Repository, statsService *stats.Service, fileRepo *files.Repository, userRepo *users.Repository, auditRepo *audit.Repository, integrityService *integrity.Service, retentionService *retention.Service) *AdminHandler {
+	return &AdminHandler{
+		authService:    authService,
+		accountService: accountService,
+		settingsRepo:   settingsRepo,
+		attemptRepo:    attemptRepo,
+		orgRepo:        orgRepo,
+		statsService:   statsService,
+		fileRepo:       fileRepo,
+		userRepo:       userRepo,
+		auditRepo:      auditRepo,
+		integrity:      integrityService,
+		retention:      retentionService,
+	}
+}
+
+// ListUserSessions returns a user's active sessions
+func (h *AdminHandler) ListUserSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	sessions, err := h.authService.ListUserSessions(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// LogoutUser ends every session of a user, effective immediately
+func (h *AdminHandler) LogoutUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionUserLoggedOut, audit.TargetUser, userID.String(), nil)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user logged out"})
+}
+
+// GetSettings returns the instance-wide settings
+func (h *AdminHandler) GetSettings(c *gin.Context) {
+	current, err := h.settingsRepo.Load()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, current)
+}
+
+// UpdateSettings changes the settings present in the request body
+func (h *AdminHandler) UpdateSettings(c *gin.Context) {
+	var req settings.UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.settingsRepo.Update(&req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionSettingsUpdated, audit.TargetSettings, "", audit.Details{"settings": updated})) {
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// ListLoginAttempts returns recent password logins, newest first, filtered
+// by email, IP or failures only
+func (h *AdminHandler) ListLoginAttempts(c *gin.Context) {
+	var query auth.LoginAttemptQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempts, err := h.attemptRepo.List(&query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// GetOrgStats returns members, files and storage per organization
+func (h *AdminHandler) GetOrgStats(c *gin.Context) {
+	stats, err := h.orgRepo.Stats()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": stats})
 }
 
-// GetStats returns system statistics
+// UpdateOrgQuota sets the storage pool an organization's uploads draw from
+func (h *AdminHandler) UpdateOrgQuota(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid org id"})
+		return
+	}
+
+	var req orgs.UpdateQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.orgRepo.UpdateQuota(orgID, req.StorageQuota); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionOrgQuotaChanged, audit.TargetOrg, orgID.String(), audit.Details{"storage_quota": req.StorageQuota})) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "organization quota updated"})
+}
+
+// GetStats returns system statistics. Figures are up to a minute old
+// unless ?refresh=true is given.
 func (h *AdminHandler) GetStats(c *gin.Context) {
-	// Check if user is admin
-	userRole, exists := c.Get("user_role")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-		return
-	}
-
-	// Mock data - in a real implementation, this would query the database
-	stats := gin.H{
-		"totalUsers":       156,
-		"totalFiles":       2847,
-		"totalStorage":     21474836480, // 20 GB in bytes
-		"activeUsers":      89,
-		"storageUsed":      8589934592,  // 8 GB in bytes
-		"downloadsToday":   234,
-		"uploadsToday":     45,
-		"storageQuota":     107374182400, // 100 GB in bytes
-		"avgFileSize":      7340032,      // ~7 MB
-		"totalDownloads":   15432,
-		"recentUploads": []gin.H{
-			{
-				"id":          "1",
-				"name":        "annual-report.pdf",
-				"user_email":  "john@example.com",
-				"size":        2457600,
-				"uploaded_at": "2024-01-15T10:30:00Z",
-			},
-			{
-				"id":          "2",
-				"name":        "presentation.pptx",
-				"user_email":  "jane@example.com",
-				"size":        5120000,
-				"uploaded_at": "2024-01-15T09:15:00Z",
-			},
-		},
+	stats, err := h.statsService.Overview(c.Query("refresh") == "true")
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetAllFiles returns all files across all users (admin view)
+// GetAllFiles searches files across all users (admin view)
 func (h *AdminHandler) GetAllFiles(c *gin.Context) {
-	// Check if user is admin
-	userRole, exists := c.Get("user_role")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-		return
-	}
-
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	search := c.Query("search")
-
-	// Mock data - in a real implementation, this would query the database
-	files := []gin.H{
-		{
-			"id":         "1",
-			"name":       "annual-report.pdf",
-			"size":       2457600,
-			"mime_type":  "application/pdf",
-			"user_id":    "user1",
-			"user_email": "john@example.com",
-			"is_public":  true,
-			"created_at": "2024-01-15T10:30:00Z",
-			"downloads":  45,
-		},
-		{
-			"id":         "2",
-			"name":       "presentation.pptx",
-			"size":       5120000,
-			"mime_type":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
-			"user_id":    "user2",
-			"user_email": "jane@example.com",
-			"is_public":  false,
-			"created_at": "2024-01-15T09:15:00Z",
-			"downloads":  23,
-		},
-		{
-			"id":         "3",
-			"name":       "screenshot.png",
-			"size":       1024000,
-			"mime_type":  "image/png",
-			"user_id":    "user3",
-			"user_email": "bob@example.com",
-			"is_public":  true,
-			"created_at": "2024-01-14T16:45:00Z",
-			"downloads":  12,
-		},
-	}
-
-	// Filter by search if provided
-	if search != "" {
-		filteredFiles := []gin.H{}
-		for _, file := range files {
-			if name, ok := file["name"].(string); ok && contains(name, search) {
-				filteredFiles = append(filteredFiles, file)
-			}
-		}
-		files = filteredFiles
+	var query files.AdminFileQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start > len(files) {
-		files = []gin.H{}
-	} else if end > len(files) {
-		files = files[start:]
-	} else {
-		files = files[start:end]
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		query.UserID = &id
 	}
+	query.Page, query.PageSize = listing.Page(query.Page, query.PageSize)
 
-	response := gin.H{
-		"files":       files,
-		"total":       len(files),
-		"page":        page,
-		"page_size":   pageSize,
-		"total_pages": (len(files) + pageSize - 1) / pageSize,
+	fileList, total, err := h.fileRepo.AdminListFiles(&query)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{
+		"files":       fileList,
+		"total":       total,
+		"page":        query.Page,
+		"page_size":   query.PageSize,
+		"total_pages": listing.TotalPages(total, query.PageSize),
+	})
 }
 
-// GetAllUsers returns all users (admin view)
+// GetAllUsers searches all users (admin view)
 func (h *AdminHandler) GetAllUsers(c *gin.Context) {
-	// Check if user is admin
-	userRole, exists := c.Get("user_role")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-		return
-	}
-
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	search := c.Query("search")
-
-	// Mock data - in a real implementation, this would query the database
-	users := []gin.H{
-		{
-			"id":             "user1",
-			"email":          "john@example.com",
-			"role":           "user",
-			"storage_quota":  1073741824, // 1 GB
-			"storage_used":   524288000,  // 500 MB
-			"created_at":     "2024-01-01T00:00:00Z",
-			"last_login":     "2024-01-15T10:00:00Z",
-			"files_count":    15,
-			"downloads":      234,
-		},
-		{
-			"id":             "user2",
-			"email":          "jane@example.com",
-			"role":           "user",
-			"storage_quota":  2147483648, // 2 GB
-			"storage_used":   1048576000, // 1 GB
-			"created_at":     "2024-01-02T00:00:00Z",
-			"last_login":     "2024-01-15T09:30:00Z",
-			"files_count":    28,
-			"downloads":      456,
-		},
-		{
-			"id":             "user3",
-			"email":          "bob@example.com",
-			"role":           "admin",
-			"storage_quota":  10737418240, // 10 GB
-			"storage_used":   2147483648,  // 2 GB
-			"created_at":     "2023-12-15T00:00:00Z",
-			"last_login":     "2024-01-15T08:15:00Z",
-			"files_count":    67,
-			"downloads":      1234,
-		},
-	}
-
-	// Filter by search if provided
-	if search != "" {
-		filteredUsers := []gin.H{}
-		for _, user := range users {
-			if email, ok := user["email"].(string); ok && contains(email, search) {
-				filteredUsers = append(filteredUsers, user)
-			}
-		}
-		users = filteredUsers
+	var query users.AdminUserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	query.Page, query.PageSize = listing.Page(query.Page, query.PageSize)
 
-	// Pagination
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start > len(users) {
-		users = []gin.H{}
-	} else if end > len(users) {
-		users = users[start:]
-	} else {
-		users = users[start:end]
+	userList, total, err := h.userRepo.AdminList(&query)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	response := gin.H{
-		"users":       users,
-		"total":       len(users),
-		"page":        page,
-		"page_size":   pageSize,
-		"total_pages": (len(users) + pageSize - 1) / pageSize,
+	c.JSON(http.StatusOK, gin.H{
+		"users":       userList,
+		"total":       total,
+		"page":        query.Page,
+		"page_size":   query.PageSize,
+		"total_pages": listing.TotalPages(total, query.PageSize),
+	})
+}
+
+// ListAuditEvents searches the audit log. Filters: actor_id, action,
+// target_type, target_id, ip, from and to. With ?format=csv or
+// ?format=ndjson every match is exported instead of one page.
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	query, ok := bindAuditQuery(c)
+	if !ok {
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	writeAuditLog(c, h.auditRepo, query)
 }
 
-// Helper function to check if string contains substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || containsIgnoreCase(s, substr))
-}
+// ListUserAuditEvents is ListAuditEvents limited to what a user did and
+// what was done to their account.
+func (h *AdminHandler) ListUserAuditEvents(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	query, ok := bindAuditQuery(c)
+	if !ok {
+		return
+	}
+	query.UserID = &userID
 
-func containsIgnoreCase(s, substr string) bool {
-	s, substr = strings.ToLower(s), strings.ToLower(substr)
-	return strings.Contains(s, substr)
+	writeAuditLog(c, h.auditRepo, query)
 }
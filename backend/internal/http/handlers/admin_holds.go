@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+)
+
+// CreateHold places a legal hold or retention lock on a file or folder.
+// Held files cannot be deleted, and their owners cannot be purged, until
+// the hold is released or the lock expires.
+func (h *AdminHandler) CreateHold(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	adminID := userID.(uuid.UUID)
+
+	var req files.CreateHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hold := &files.Hold{
+		ID:          uuid.New(),
+		Kind:        req.Kind,
+		Reason:      req.Reason,
+		RetainUntil: req.RetainUntil,
+		Status:      "active",
+		CreatedBy:   &adminID,
+		CreatedAt:   time.Now(),
+	}
+
+	switch {
+	case req.Kind == files.HoldKindRetention && req.RetainUntil == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retention locks need retain_until"})
+		return
+	case req.Kind == files.HoldKindRetention && !req.RetainUntil.After(hold.CreatedAt):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retain_until must be in the future"})
+		return
+	case req.Kind == files.HoldKindLegal && req.RetainUntil != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legal holds last until released and take no retain_until"})
+		return
+	}
+
+	switch {
+	case req.FileID != nil && req.FolderID != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pass either file_id or folder_id"})
+		return
+	case req.FileID != nil:
+		file, err := h.fileRepo.GetFileByID(*req.FileID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		hold.TargetType, hold.FileID, hold.TargetName = files.HoldTargetFile, req.FileID, file.Name
+	case req.FolderID != nil:
+		folder, err := h.fileRepo.GetFolderByID(*req.FolderID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		hold.TargetType, hold.FolderID, hold.TargetName = files.HoldTargetFolder, req.FolderID, folder.Name
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_id or folder_id is required"})
+		return
+	}
+
+	if err := h.fileRepo.CreateHold(hold); err != nil {
+		c.Error(err)
+		return
+	}
+	affected, err := h.fileRepo.CountHoldFiles(hold)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	details := audit.Details{"kind": hold.Kind, "target_type": hold.TargetType, "reason": hold.Reason, "files_affected": affected}
+	if hold.FileID != nil {
+		details["file_id"] = hold.FileID.String()
+	}
+	if hold.FolderID != nil {
+		details["folder_id"] = hold.FolderID.String()
+	}
+	if hold.RetainUntil != nil {
+		details["retain_until"] = hold.RetainUntil
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionHoldCreated, audit.TargetHold, hold.ID.String(), details)) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"hold": hold, "files_affected": affected})
+}
+
+// ListHolds returns holds, filtered with ?kind=legal_hold|retention and
+// ?status=active|released|expired
+func (h *AdminHandler) ListHolds(c *gin.Context) {
+	kind, status := c.Query("kind"), c.Query("status")
+	if kind != "" && kind != files.HoldKindLegal && kind != files.HoldKindRetention {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be legal_hold or retention"})
+		return
+	}
+	if status != "" && status != "active" && status != "released" && status != "expired" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, released or expired"})
+		return
+	}
+
+	holds, err := h.fileRepo.ListHolds(kind, status)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"holds": holds})
+}
+
+// ReleaseHold lifts a legal hold. Retention locks cannot be released.
+func (h *AdminHandler) ReleaseHold(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hold id"})
+		return
+	}
+
+	var req files.ReleaseHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.fileRepo.ReleaseHold(id, userID.(uuid.UUID), req.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionHoldReleased, audit.TargetHold, id.String(), audit.Details{"reason": req.Reason})) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "hold released"})
+}
+
+// ExtendHold moves a retention lock's end later
+func (h *AdminHandler) ExtendHold(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hold id"})
+		return
+	}
+
+	var req files.ExtendHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.fileRepo.ExtendHold(id, req.RetainUntil); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionHoldExtended, audit.TargetHold, id.String(), audit.Details{"retain_until": req.RetainUntil})) {
+		return
+	}
+
+	hold, err := h.fileRepo.GetHold(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hold": hold})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samridh-111/balkan_task/internal/core/integrity"
+)
+
+// VerifyLogs recomputes the hash chain of the audit or download log, or of
+// both when no chain is given, and reports where it was tampered with.
+func (h *AdminHandler) VerifyLogs(c *gin.Context) {
+	chains := integrity.Chains
+	if chain := c.Query("chain"); chain != "" {
+		chains = []string{chain}
+	}
+
+	reports := make([]*integrity.Report, 0, len(chains))
+	valid := true
+	for _, chain := range chains {
+		report, err := h.integrity.Verify(chain)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		valid = valid && report.Valid
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": valid, "chains": reports})
+}
+
+// ListCheckpoints returns the recorded heads of a chain, oldest first
+func (h *AdminHandler) ListCheckpoints(c *gin.Context) {
+	chain := c.Query("chain")
+	if chain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chain is required"})
+		return
+	}
+	checkpoints, err := h.integrity.ListCheckpoints(chain)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chain": chain, "checkpoints": checkpoints})
+}
+
+// CreateCheckpoint records the current head of every chain that grew since
+// its last checkpoint, without waiting for the next scheduled one.
+func (h *AdminHandler) CreateCheckpoint(c *gin.Context) {
+	checkpoints, err := h.integrity.Checkpoint()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"checkpoints": checkpoints})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samridh-111/balkan_task/internal/core/stats"
+)
+
+const (
+	defaultStorageLimit = 10
+	maxStorageLimit     = 100
+)
+
+// storageLimit reads ?limit, defaulting to 10 and capped at 100.
+func storageLimit(c *gin.Context) (int, bool) {
+	limit := defaultStorageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return 0, false
+		}
+		limit = n
+	}
+	if limit > maxStorageLimit {
+		limit = maxStorageLimit
+	}
+	return limit, true
+}
+
+// GetStorageSeries returns daily storage usage from the snapshots for
+// charting: the total, one series per MIME category, or the largest users.
+// ?key picks a single user ID or category.
+func (h *AdminHandler) GetStorageSeries(c *gin.Context) {
+	from, to, err := parseRange(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	limit, ok := storageLimit(c)
+	if !ok {
+		return
+	}
+
+	query := &stats.SeriesQuery{
+		Dimension: c.DefaultQuery("dimension", stats.DimensionTotal),
+		Key:       c.Query("key"),
+		From:      from,
+		To:        to,
+		Limit:     limit,
+	}
+	series, err := h.statsService.UsageSeries(query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dimension": query.Dimension, "from": from, "to": to, "series": series})
+}
+
+// GetStorageTop ranks users or MIME categories by logical_bytes,
+// physical_bytes or file_count on the latest snapshot, or on ?day.
+func (h *AdminHandler) GetStorageTop(c *gin.Context) {
+	limit, ok := storageLimit(c)
+	if !ok {
+		return
+	}
+
+	query := &stats.TopQuery{
+		Dimension: c.DefaultQuery("dimension", stats.DimensionUser),
+		By:        c.Query("by"),
+		Limit:     limit,
+	}
+	if raw := c.Query("day"); raw != "" {
+		day, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid day"})
+			return
+		}
+		query.Day = day
+	}
+
+	entries, day, err := h.statsService.TopUsage(query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := gin.H{"dimension": query.Dimension, "day": nil, "entries": entries}
+	if !day.IsZero() {
+		response["day"] = day.Format("2006-01-02")
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TakeStorageSnapshot records today's storage usage now, replacing the
+// snapshot already taken today.
+func (h *AdminHandler) TakeStorageSnapshot(c *gin.Context) {
+	day, err := h.statsService.TakeSnapshot()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"day": day.Format("2006-01-02")})
+}
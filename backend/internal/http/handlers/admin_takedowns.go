@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// CreateTakedown takes down a file, or with scope "content" every file with
+// the same content, which also refuses future uploads of it. Taken down
+// files stay in storage so the takedown can be lifted.
+func (h *AdminHandler) CreateTakedown(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	adminID := userID.(uuid.UUID)
+
+	var req files.CreateTakedownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	takedown := &files.Takedown{
+		ID:        uuid.New(),
+		Scope:     req.Scope,
+		FileID:    req.FileID,
+		Reason:    req.Reason,
+		Status:    "active",
+		CreatedBy: &adminID,
+		CreatedAt: time.Now(),
+	}
+
+	switch {
+	case req.FileID != nil:
+		if takedown.Scope == "" {
+			takedown.Scope = files.TakedownScopeFile
+		}
+		file, err := h.fileRepo.GetFileByID(*req.FileID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		content, err := h.fileRepo.GetFileContentByID(file.FileContentID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		takedown.SHA256Hash = content.SHA256Hash
+	case req.SHA256Hash != "":
+		takedown.SHA256Hash = strings.ToLower(req.SHA256Hash)
+		if !sha256Pattern.MatchString(takedown.SHA256Hash) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sha256_hash must be 64 hex characters"})
+			return
+		}
+		if takedown.Scope == "" {
+			takedown.Scope = files.TakedownScopeContent
+		}
+		if takedown.Scope != files.TakedownScopeContent {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a hash can only be taken down with scope content"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_id or sha256_hash is required"})
+		return
+	}
+	if takedown.Scope != files.TakedownScopeFile && takedown.Scope != files.TakedownScopeContent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be file or content"})
+		return
+	}
+	if takedown.Scope == files.TakedownScopeContent {
+		// A content takedown is about the bytes, not the file it was found by
+		takedown.FileID = nil
+	}
+
+	if err := h.fileRepo.CreateTakedown(takedown); err != nil {
+		c.Error(err)
+		return
+	}
+
+	affected := 1
+	if takedown.Scope == files.TakedownScopeContent {
+		n, err := h.fileRepo.CountContentFiles(takedown.SHA256Hash)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		affected = n
+	}
+
+	details := audit.Details{"scope": takedown.Scope, "sha256_hash": takedown.SHA256Hash, "reason": takedown.Reason, "files_affected": affected}
+	if req.FileID != nil {
+		details["file_id"] = req.FileID.String()
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionTakedownCreated, audit.TargetTakedown, takedown.ID.String(), details)) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"takedown": takedown, "files_affected": affected})
+}
+
+// ListTakedowns returns takedowns, filtered with ?status=active|lifted
+func (h *AdminHandler) ListTakedowns(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != "active" && status != "lifted" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or lifted"})
+		return
+	}
+
+	takedowns, err := h.fileRepo.ListTakedowns(status)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"takedowns": takedowns})
+}
+
+// LiftTakedown makes the taken down file or content available again
+func (h *AdminHandler) LiftTakedown(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid takedown id"})
+		return
+	}
+
+	var req files.LiftTakedownRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.fileRepo.LiftTakedown(id, userID.(uuid.UUID), req.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionTakedownLifted, audit.TargetTakedown, id.String(), audit.Details{"reason": req.Reason})) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "takedown lifted"})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+var errSelfAction = errors.New(http.StatusBadRequest, "admins cannot do this to their own account")
+
+// targetUser loads the user named by the :id parameter. With notSelf, the
+// caller may not be that user, so an admin cannot lock themselves out.
+func (h *AdminHandler) targetUser(c *gin.Context, notSelf bool) (*users.User, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return nil, false
+	}
+	if callerID, _ := c.Get("user_id"); notSelf && callerID == userID {
+		c.Error(errSelfAction)
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return user, true
+}
+
+// recordUserAction audits an admin action on a user.
+func (h *AdminHandler) recordUserAction(c *gin.Context, action string, user *users.User, details audit.Details) bool {
+	return recordAudit(c, h.auditRepo, auditEvent(c, action, audit.TargetUser, user.ID.String(), details))
+}
+
+// UpdateUserRole changes a user's role and signs them out, so the new
+// role applies to every request from then on
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	user, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	var req users.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !rbac.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	if err := h.userRepo.UpdateRole(user.ID, req.Role); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.authService.RevokeAllSessions(user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordUserAction(c, audit.ActionUserRoleChanged, user, audit.Details{"from": user.Role, "to": req.Role}) {
+		return
+	}
+
+	user.Role = req.Role
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserQuota sets a user's storage quota in bytes
+func (h *AdminHandler) UpdateUserQuota(c *gin.Context) {
+	user, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	var req users.UpdateQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userRepo.UpdateQuota(user.ID, req.StorageQuota); err != nil {
+		c.Error(err)
+		return
+	}
+	details := audit.Details{"from": user.StorageQuota, "to": req.StorageQuota}
+	if !h.recordUserAction(c, audit.ActionUserQuotaChanged, user, details) {
+		return
+	}
+
+	user.StorageQuota = req.StorageQuota
+	c.JSON(http.StatusOK, user)
+}
+
+// SuspendUser blocks a user from signing in and ends their sessions. API
+// keys stop working too.
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	user, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	var req users.SuspendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userRepo.Suspend(user.ID, req.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.authService.RevokeAllSessions(user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordUserAction(c, audit.ActionUserSuspended, user, audit.Details{"reason": req.Reason}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user suspended"})
+}
+
+func (h *AdminHandler) UnsuspendUser(c *gin.Context) {
+	user, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.Unsuspend(user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordUserAction(c, audit.ActionUserUnsuspended, user, nil) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unsuspended"})
+}
+
+// ResetUserPassword disables a user's password and mails them a reset link
+func (h *AdminHandler) ResetUserPassword(c *gin.Context) {
+	user, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	if err := h.accountService.AdminResetPassword(user.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordUserAction(c, audit.ActionUserPasswordReset, user, nil) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset, a link to set a new one was sent to the user"})
+}
+
+// DeleteUser deletes a user. The caller must choose what happens to their
+// files: ?transfer_to=<user id> hands them to another user, ?purge=true
+// deletes them.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	transferParam, purge := c.Query("transfer_to"), c.Query("purge") == "true"
+	if (transferParam == "") == !purge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pass either transfer_to or purge=true"})
+		return
+	}
+
+	details := audit.Details{"email": user.Email, "files": "purge"}
+	var transferTo *uuid.UUID
+	if transferParam != "" {
+		id, err := uuid.Parse(transferParam)
+		if err != nil || id == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transfer_to user id"})
+			return
+		}
+		if _, err := h.userRepo.GetByID(id); err != nil {
+			if err == errors.ErrNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "transfer_to user not found"})
+				return
+			}
+			c.Error(err)
+			return
+		}
+		transferTo = &id
+		details["files"] = "transfer"
+		details["transfer_to"] = id.String()
+	}
+
+	result, err := h.userRepo.Delete(user.ID, transferTo)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// Blobs are only removed once the deletion has committed, so a failed
+	// deletion never leaves files without their content.
+	for _, path := range result.BlobPaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			result.BlobsNotRemoved++
+		}
+	}
+	details["files_transferred"] = result.FilesTransferred
+	details["files_purged"] = result.FilesPurged
+	if transferTo == nil {
+		details["contents_removed"] = result.ContentsRemoved
+		details["bytes_reclaimed"] = result.BytesReclaimed
+		details["blobs_not_removed"] = result.BlobsNotRemoved
+	}
+	if !h.recordUserAction(c, audit.ActionUserDeleted, user, details) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted", "result": result})
+}
+
+// ImpersonateUser issues a short-lived token for acting as a user while
+// helping them. The token is read-only unless allow_writes is set, and
+// every request made with it is audited.
+func (h *AdminHandler) ImpersonateUser(c *gin.Context) {
+	user, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	var req auth.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	resp, err := h.authService.Impersonate(claims.(*auth.Claims), user, &req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	details := audit.Details{"reason": req.Reason, "expires_at": resp.ExpiresAt, "allow_writes": req.AllowWrites}
+	if !h.recordUserAction(c, audit.ActionUserImpersonated, user, details) {
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
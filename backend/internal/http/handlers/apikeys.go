@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+)
+
+// requireLoginSession rejects requests made with an API key. Credentials
+// and second factors can only be managed from a login session, so a leaked
+// key cannot be used to mint further keys or lock the owner out.
+func requireLoginSession(c *gin.Context) bool {
+	claims, _ := c.Get("claims")
+	if cl, ok := claims.(*auth.Claims); ok && cl.APIKeyID != uuid.Nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint requires a login session"})
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	var req auth.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("user_role")
+	user := &users.User{ID: userID.(uuid.UUID), Role: role.(string)}
+
+	resp, err := h.authService.CreateAPIKey(user, &req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	details := audit.Details{"name": resp.APIKey.Name, "scopes": resp.APIKey.Scopes}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionAPIKeyCreated, audit.TargetAPIKey, resp.APIKey.ID.String(), details)) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	keys, err := h.authService.ListAPIKeys(userID.(uuid.UUID))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.authService.RevokeAPIKey(id, userID.(uuid.UUID)); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionAPIKeyRevoked, audit.TargetAPIKey, id.String(), nil)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
+)
+
+// auditEvent describes an action taken in this request, attributed to the
+// signed-in user and the client it came from.
+func auditEvent(c *gin.Context, action, targetType, targetID string, details audit.Details) *audit.Event {
+	e := &audit.Event{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		RequestID:  c.GetString("request_id"),
+		Details:    details,
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		id := userID.(uuid.UUID)
+		e.ActorID = &id
+	}
+	// Actions taken while impersonating belong to the admin.
+	if adminID, ok := c.Get("impersonator_id"); ok {
+		id := adminID.(uuid.UUID)
+		if e.Details == nil {
+			e.Details = audit.Details{}
+		}
+		e.Details["on_behalf_of"] = e.ActorID.String()
+		e.ActorID = &id
+	}
+	return e
+}
+
+// recordAudit stores e, failing the request if it cannot be recorded: an
+// action that leaves no trace must not look successful.
+func recordAudit(c *gin.Context, repo *audit.Repository, e *audit.Event) bool {
+	if err := repo.Record(e); err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
+
+// bindAuditQuery reads the audit log filters from the query string.
+func bindAuditQuery(c *gin.Context) (*audit.Query, bool) {
+	var query audit.Query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor id"})
+			return nil, false
+		}
+		query.ActorID = &id
+	}
+	query.Page, query.PageSize = listing.Page(query.Page, query.PageSize)
+	return &query, true
+}
+
+var auditCSVHeader = []string{"created_at", "id", "actor_id", "actor_email", "action", "target_type", "target_id",
+	"ip_address", "user_agent", "request_id", "details"}
+
+// writeAuditLog responds with one page of events, or with ?format=csv or
+// ?format=ndjson, streams every match as a download.
+func writeAuditLog(c *gin.Context, repo *audit.Repository, query *audit.Query) {
+	format := c.DefaultQuery("format", "json")
+	if format == "json" {
+		events, total, err := repo.List(query)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"events":      events,
+			"total":       total,
+			"page":        query.Page,
+			"page_size":   query.PageSize,
+			"total_pages": listing.TotalPages(total, query.PageSize),
+		})
+		return
+	}
+
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or ndjson"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().UTC().Format("20060102-150405"), format))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent; on error stop and leave a truncated export.
+	var err error
+	if format == "csv" {
+		err = writeAuditCSV(c.Writer, repo, query)
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		err = repo.Each(query, func(e *audit.Event) error { return enc.Encode(e) })
+	}
+	if err != nil {
+		c.Error(errors.Wrap(500, "failed to write export", err))
+	}
+}
+
+func writeAuditCSV(out io.Writer, repo *audit.Repository, query *audit.Query) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(auditCSVHeader); err != nil {
+		return err
+	}
+	err := repo.Each(query, func(e *audit.Event) error {
+		actorID := ""
+		if e.ActorID != nil {
+			actorID = e.ActorID.String()
+		}
+		details, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		return w.Write([]string{e.CreatedAt.UTC().Format(time.RFC3339), e.ID.String(), actorID, e.ActorEmail,
+			e.Action, e.TargetType, e.TargetID, e.IPAddress, e.UserAgent, e.RequestID, string(details)})
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
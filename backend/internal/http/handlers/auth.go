@@ -2,19 +2,63 @@
 package handlers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
 	"github.com/samridh-111/balkan_task/internal/core/auth"
 	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
 )
 
 type AuthHandler struct {
-	authService *auth.AuthService
+	authService    *auth.AuthService
+	mfaService     *auth.MFAService
+	accountService *auth.AccountService
+	auditRepo      *audit.Repository
 }
 
-func NewAuthHandler(authService *auth.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *auth.AuthService, mfaService *auth.MFAService, accountService *auth.AccountService, auditRepo *audit.Repository) *AuthHandler {
+	return &AuthHandler{authService: authService, mfaService: mfaService, accountService: accountService, auditRepo: auditRepo}
+}
+
+// recordLogin audits a completed sign-in. The request is not authenticated
+// yet, so the user is set as the actor explicitly.
+func recordLogin(c *gin.Context, repo *audit.Repository, user *users.User, method string) bool {
+	e := auditEvent(c, audit.ActionLogin, audit.TargetUser, user.ID.String(), audit.Details{"method": method})
+	e.ActorID = &user.ID
+	return recordAudit(c, repo, e)
+}
+
+// recordLoginFailure audits a rejected sign-in. Server errors say nothing
+// about the credentials and are not recorded.
+func recordLoginFailure(c *gin.Context, repo *audit.Repository, err error, details audit.Details) bool {
+	reason := err.Error()
+	switch err {
+	case errors.ErrUnauthorized:
+		reason = auth.AttemptInvalidCredentials
+	case auth.ErrEmailNotVerified:
+		reason = auth.AttemptEmailNotVerified
+	case auth.ErrAccountSuspended:
+		reason = auth.AttemptAccountSuspended
+	default:
+		if _, ok := err.(*auth.LoginThrottledError); ok {
+			reason = auth.AttemptThrottled
+		} else if appErr, ok := err.(*errors.AppError); !ok || appErr.Code >= 500 {
+			return true
+		}
+	}
+	details["reason"] = reason
+	return recordAudit(c, repo, auditEvent(c, audit.ActionLoginFailed, "", "", details))
+}
+
+// clientInfo describes the client making the request, for login throttling
+// and the session list.
+func clientInfo(c *gin.Context) auth.ClientInfo {
+	return auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -24,12 +68,19 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Register(&req)
+	user, resp, err := h.authService.Register(&req, clientInfo(c))
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
+	// The account exists either way; the user can ask for another link.
+	_ = h.accountService.SendVerificationEmail(user.ID)
+
+	if resp == nil {
+		c.JSON(http.StatusCreated, gin.H{"user": user, "status": "verification_required"})
+		return
+	}
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -40,12 +91,85 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(&req)
+	resp, challenge, err := h.authService.Login(&req, clientInfo(c))
+	if err != nil && !recordLoginFailure(c, h.auditRepo, err, audit.Details{"method": "password", "email": req.Email}) {
+		return
+	}
+	if throttled, ok := err.(*auth.LoginThrottledError); ok {
+		retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts", "retry_after": retryAfter})
+		return
+	}
 	if err != nil {
 		c.Error(err)
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	if !recordLogin(c, h.auditRepo, &resp.User, "password") {
+		return
+	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req users.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.Refresh(req.RefreshToken, clientInfo(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, _ := c.Get("claims")
+
+	if err := h.authService.Logout(claims.(*auth.Claims)); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionLogout, audit.TargetSession, claims.(*auth.Claims).SessionID.String(), nil)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// JWKS publishes the public keys that verify our access tokens, for other
+// services that check them independently.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	set, ok := h.authService.JWKS()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tokens are signed with a shared secret (HS256); no public keys to publish"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+// ListAuditEvents returns the caller's own audit trail: what they did and
+// what was done to their account. It takes the same filters and export
+// formats as the admin audit log.
+func (h *AuthHandler) ListAuditEvents(c *gin.Context) {
+	query, ok := bindAuditQuery(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("user_id")
+	id := userID.(uuid.UUID)
+	query.UserID = &id
+
+	writeAuditLog(c, h.auditRepo, query)
+}
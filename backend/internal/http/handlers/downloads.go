@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/listing"
+)
+
+// bindDownloadQuery reads the download log filters from the query string.
+// The ID filters named in ids are parsed when present.
+func bindDownloadQuery(c *gin.Context, ids ...string) (*files.DownloadQuery, bool) {
+	var query files.DownloadQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	for _, name := range ids {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+			return nil, false
+		}
+		switch name {
+		case "file_id":
+			query.FileID = &id
+		case "user_id":
+			query.UserID = &id
+		case "share_id":
+			query.ShareID = &id
+		}
+	}
+	query.Page, query.PageSize = listing.Page(query.Page, query.PageSize)
+	return &query, true
+}
+
+// writeDownloads responds with one page of downloads. Daily counts kept
+// for pruned downloads are included when no filter asks who downloaded.
+func writeDownloads(c *gin.Context, repo *files.Repository, query *files.DownloadQuery) {
+	downloads, total, err := repo.ListDownloads(query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := gin.H{
+		"downloads":   downloads,
+		"total":       total,
+		"page":        query.Page,
+		"page_size":   query.PageSize,
+		"total_pages": listing.TotalPages(total, query.PageSize),
+	}
+	if query.UserID == nil && query.ShareID == nil {
+		archived, err := repo.ListArchivedDownloads(query)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		response["archived"] = archived
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// FileDownloads lists downloads of one of the caller's files, newest
+// first. Filters: user_id, share_id, from and to.
+func (h *FileHandler) FileDownloads(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := h.fileRepo.GetFileByID(fileID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.authorizeFile(file, currentUserID(c), true); err != nil {
+		c.Error(err)
+		return
+	}
+
+	query, ok := bindDownloadQuery(c, "user_id", "share_id")
+	if !ok {
+		return
+	}
+	query.FileID = &file.ID
+
+	writeDownloads(c, h.fileRepo, query)
+}
+
+// ListDownloads searches the download log across every file. Filters:
+// file_id, user_id, share_id, from and to.
+func (h *AdminHandler) ListDownloads(c *gin.Context) {
+	query, ok := bindDownloadQuery(c, "file_id", "user_id", "share_id")
+	if !ok {
+		return
+	}
+
+	writeDownloads(c, h.fileRepo, query)
+}
+
+// ApplyRetention runs the download log retention policy now instead of
+// waiting for the next scheduled run.
+func (h *AdminHandler) ApplyRetention(c *gin.Context) {
+	result, err := h.retention.Run()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	event := auditEvent(c, audit.ActionRetentionApplied, "", "", audit.Details{
+		"ips_anonymized":   result.IPsAnonymized,
+		"downloads_pruned": result.DownloadsPruned,
+	})
+	if !recordAudit(c, h.auditRepo, event) {
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
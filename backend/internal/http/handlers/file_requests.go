@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+func (h *FileHandler) CreateFileRequest(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	var req files.CreateFileRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.MaxFileSize != nil && *req.MaxFileSize <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_file_size must be positive"})
+		return
+	}
+	if req.MaxFiles != nil && *req.MaxFiles <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_files must be positive"})
+		return
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	if req.FolderID != nil {
+		if _, err := h.ownedFolderID(req.FolderID.String(), userUUID); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	fileRequest := &files.FileRequest{
+		ID:               uuid.New(),
+		UserID:           userUUID,
+		FolderID:         req.FolderID,
+		Token:            token.New(24),
+		Title:            req.Title,
+		MaxFileSize:      req.MaxFileSize,
+		AllowedMimeTypes: req.AllowedMimeTypes,
+		MaxFiles:         req.MaxFiles,
+		ExpiresAt:        req.ExpiresAt,
+		CreatedAt:        time.Now(),
+	}
+
+	if err := h.fileRepo.CreateFileRequest(fileRequest); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, fileRequest)
+}
+
+func (h *FileHandler) ListFileRequests(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	requests, err := h.fileRepo.ListFileRequests(userUUID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file_requests": requests})
+}
+
+func (h *FileHandler) RevokeFileRequest(c *gin.Context) {
+	fileRequest, ok := h.ownedFileRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileRepo.RevokeFileRequest(fileRequest.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "file request revoked"})
+}
+
+func (h *FileHandler) ListFileRequestSubmissions(c *gin.Context) {
+	fileRequest, ok := h.ownedFileRequest(c)
+	if !ok {
+		return
+	}
+
+	submissions, err := h.fileRepo.ListFileRequestSubmissions(fileRequest.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"submissions": submissions})
+}
+
+// GetPublicFileRequest describes an open file request to an anonymous
+// uploader without revealing anything about the owner.
+func (h *FileHandler) GetPublicFileRequest(c *gin.Context) {
+	fileRequest, err := h.activeFileRequest(c.Param("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := gin.H{
+		"title":              fileRequest.Title,
+		"max_file_size":      fileRequest.MaxFileSize,
+		"allowed_mime_types": fileRequest.AllowedMimeTypes,
+		"expires_at":         fileRequest.ExpiresAt,
+	}
+	if fileRequest.MaxFiles != nil {
+		response["files_remaining"] = *fileRequest.MaxFiles - fileRequest.FilesReceived
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UploadToFileRequest accepts an anonymous upload through a file request and
+// stores it in the owner's space, charged to the owner's quota. The body is
+// capped at the request's size limit, or the owner's quota without one, and
+// the file type is detected from its content rather than trusted from the
+// uploader.
+func (h *FileHandler) UploadToFileRequest(c *gin.Context) {
+	fileRequest, err := h.activeFileRequest(c.Param("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	owner, err := h.userRepo.GetByID(fileRequest.UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	limit := owner.StorageQuota
+	if fileRequest.MaxFileSize != nil {
+		limit = *fileRequest.MaxFileSize
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the size limit of this request"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	if file.Size > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the size limit of this request"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = file.Filename
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.Error(errors.Wrap(500, "failed to open file", err))
+		return
+	}
+	defer src.Close()
+
+	fileData, err := io.ReadAll(src)
+	if err != nil {
+		c.Error(errors.Wrap(500, "failed to read file", err))
+		return
+	}
+
+	mimeType := mimetype.Detect(fileData).String()
+	if !mimeAllowed(mimeType, fileRequest.AllowedMimeTypes) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "file type not accepted by this request"})
+		return
+	}
+
+	claimed, err := h.fileRepo.ClaimFileRequestSlot(fileRequest.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !claimed {
+		c.Error(errFileRequestClosed)
+		return
+	}
+
+	fileContent, err := h.storeContent(owner, nil, fileData)
+	if err != nil {
+		h.fileRepo.ReleaseFileRequestSlot(fileRequest.ID)
+		c.Error(err)
+		return
+	}
+
+	fileRecord := &files.File{
+		ID:            uuid.New(),
+		UserID:        owner.ID,
+		FileContentID: fileContent.ID,
+		FolderID:      fileRequest.FolderID,
+		Name:          name,
+		MimeType:      mimeType,
+		Size:          fileContent.Size,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	submission := &files.FileRequestSubmission{
+		ID:            uuid.New(),
+		FileRequestID: fileRequest.ID,
+		FileID:        &fileRecord.ID,
+		UploaderName:  c.PostForm("uploader_name"),
+		UploaderEmail: c.PostForm("uploader_email"),
+		IPAddress:     c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		CreatedAt:     time.Now(),
+	}
+	if err := h.fileRepo.CreateFileRequestSubmission(fileRecord, submission); err != nil {
+		h.fileRepo.ReleaseFileRequestSlot(fileRequest.ID)
+		c.Error(err)
+		return
+	}
+	if !h.recordUpload(c, fileRecord, fileContent, &fileRequest.ID) {
+		return
+	}
+	// The upload event has no actor and targets the file, so the owner
+	// gets an event of their own in their activity.
+	details := audit.Details{
+		"file_request_id": fileRequest.ID.String(),
+		"submission_id":   submission.ID.String(),
+		"file_id":         fileRecord.ID.String(),
+		"name":            fileRecord.Name,
+		"size":            fileRecord.Size,
+	}
+	if submission.UploaderName != "" {
+		details["uploader_name"] = submission.UploaderName
+	}
+	if submission.UploaderEmail != "" {
+		details["uploader_email"] = submission.UploaderEmail
+	}
+	event := auditEvent(c, audit.ActionFileRequestSubmission, audit.TargetUser, owner.ID.String(), details)
+	if !recordAudit(c, h.auditRepo, event) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "file received",
+		"name":    fileRecord.Name,
+		"size":    fileRecord.Size,
+	})
+}
+
+var errFileRequestClosed = errors.New(http.StatusGone, "file request is no longer accepting uploads")
+
+// multipartOverhead allows for the multipart framing and the other form
+// fields around an upload.
+const multipartOverhead = 1 << 20
+
+// activeFileRequest resolves a public token to a file request that still
+// accepts uploads. Revoked, expired and full requests are reported as gone.
+func (h *FileHandler) activeFileRequest(tok string) (*files.FileRequest, error) {
+	fileRequest, err := h.fileRepo.GetFileRequestByToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	if !fileRequest.Active(time.Now()) {
+		return nil, errFileRequestClosed
+	}
+	return fileRequest, nil
+}
+
+// ownedFileRequest loads the file request named by the :id parameter and
+// checks the caller owns it. It writes the error response itself.
+func (h *FileHandler) ownedFileRequest(c *gin.Context) (*files.FileRequest, bool) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file request id"})
+		return nil, false
+	}
+
+	fileRequest, err := h.fileRepo.GetFileRequestByID(requestID)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	if fileRequest.UserID != userUUID {
+		c.Error(errors.ErrForbidden)
+		return nil, false
+	}
+	return fileRequest, true
+}
+
+// mimeAllowed matches a MIME type against an allow-list. Entries may be
+// exact ("application/pdf") or a wildcard subtype ("image/*"). An empty list
+// allows everything.
+func mimeAllowed(mimeType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -7,27 +7,38 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
 	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/core/orgs"
+	"github.com/samridh-111/balkan_task/internal/core/signedurl"
 	"github.com/samridh-111/balkan_task/internal/core/users"
 	"github.com/samridh-111/balkan_task/internal/pkg/errors"
 )
 
 type FileHandler struct {
-	fileRepo  *files.Repository
-	userRepo  *users.Repository
+	fileRepo    *files.Repository
+	userRepo    *users.Repository
+	orgRepo     *orgs.Repository
+	auditRepo   *audit.Repository
+	signer      *signedurl.Signer
 	storagePath string
 }
 
-func NewFileHandler(fileRepo *files.Repository, userRepo *users.Repository, storagePath string) *FileHandler {
+func NewFileHandler(fileRepo *files.Repository, userRepo *users.Repository, orgRepo *orgs.Repository, auditRepo *audit.Repository, signer *signedurl.Signer, storagePath string) *FileHandler {
 	// Ensure storage directory exists
 	os.MkdirAll(storagePath, 0755)
 	return &FileHandler{
-		fileRepo:  fileRepo,
-		userRepo:  userRepo,
+		fileRepo:    fileRepo,
+		userRepo:    userRepo,
+		orgRepo:     orgRepo,
+		auditRepo:   auditRepo,
+		signer:      signer,
 		storagePath: storagePath,
 	}
 }
@@ -67,81 +78,227 @@ func (h *FileHandler) Upload(c *gin.Context) {
 		return
 	}
 
+	orgID, err := h.orgScope(req.OrgID, userUUID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	folderID, err := h.scopedFolderID(req.FolderID, userUUID, orgID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	fileContent, err := h.storeContent(user, orgID, fileData)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	fileRecord := &files.File{
+		ID:            uuid.New(),
+		UserID:        userUUID,
+		OrgID:         orgID,
+		FileContentID: fileContent.ID,
+		FolderID:      folderID,
+		Name:          req.Name,
+		MimeType:      file.Header.Get("Content-Type"),
+		IsPublic:      req.IsPublic,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	if err := h.fileRepo.CreateFile(fileRecord); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordUpload(c, fileRecord, fileContent, nil) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, fileRecord)
+}
+
+// recordUpload audits a new file. Uploads through a file request have no
+// actor; the request is noted in the details instead.
+func (h *FileHandler) recordUpload(c *gin.Context, file *files.File, content *files.FileContent, fileRequestID *uuid.UUID) bool {
+	details := audit.Details{"name": file.Name, "size": content.Size, "sha256_hash": content.SHA256Hash}
+	if file.OrgID != nil {
+		details["org_id"] = file.OrgID.String()
+	}
+	if fileRequestID != nil {
+		details["file_request_id"] = fileRequestID.String()
+	}
+	return recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionFileUploaded, audit.TargetFile, file.ID.String(), details))
+}
+
+// storeContent stores data under its SHA-256 hash unless identical content
+// already exists. Only new content is charged to the quota, the
+// organization's when orgID is set and the owner's otherwise.
+func (h *FileHandler) storeContent(owner *users.User, orgID *uuid.UUID, fileData []byte) (*files.FileContent, error) {
 	hash := sha256.New()
 	hash.Write(fileData)
 	sha256Hash := fmt.Sprintf("%x", hash.Sum(nil))
 
+	blocked, err := h.fileRepo.ContentBlocked(sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, files.ErrUnavailableForLegalReasons
+	}
+
 	fileContent, err := h.fileRepo.GetFileContentByHash(sha256Hash)
 	if err != nil && err != errors.ErrNotFound {
-		c.Error(err)
-		return
+		return nil, err
+	}
+	if fileContent != nil {
+		return fileContent, nil
 	}
 
 	fileSize := int64(len(fileData))
-
-	if fileContent == nil {
-		if user.StorageUsed+fileSize > user.StorageQuota {
-			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded"})
-			return
+	if orgID != nil {
+		if err := h.orgRepo.ChargeStorage(*orgID, fileSize); err != nil {
+			return nil, err
 		}
+	} else if owner.StorageUsed+fileSize > owner.StorageQuota {
+		return nil, errors.New(http.StatusForbidden, "storage quota exceeded")
 	}
 
-	if fileContent == nil {
-		storageDir := filepath.Join(h.storagePath, sha256Hash[:2])
-		os.MkdirAll(storageDir, 0755)
-		storagePath := filepath.Join(storageDir, sha256Hash)
+	storageDir := filepath.Join(h.storagePath, sha256Hash[:2])
+	os.MkdirAll(storageDir, 0755)
+	storagePath := filepath.Join(storageDir, sha256Hash)
 
-		if err := os.WriteFile(storagePath, fileData, 0644); err != nil {
-			c.Error(errors.Wrap(500, "failed to save file", err))
-			return
-		}
+	if err := os.WriteFile(storagePath, fileData, 0644); err != nil {
+		h.releaseOrgStorage(orgID, fileSize)
+		return nil, errors.Wrap(500, "failed to save file", err)
+	}
 
-		fileContent = &files.FileContent{
-			ID:          uuid.New(),
-			SHA256Hash:  sha256Hash,
-			Size:        fileSize,
-			StoragePath: storagePath,
-			CreatedAt:   time.Now(),
-		}
+	fileContent = &files.FileContent{
+		ID:          uuid.New(),
+		SHA256Hash:  sha256Hash,
+		Size:        fileSize,
+		StoragePath: storagePath,
+		CreatedAt:   time.Now(),
+	}
 
-		if err := h.fileRepo.CreateFileContent(fileContent); err != nil {
-			c.Error(err)
-			return
+	if err := h.fileRepo.CreateFileContent(fileContent); err != nil {
+		h.releaseOrgStorage(orgID, fileSize)
+		return nil, err
+	}
+
+	if orgID == nil {
+		newStorageUsed := owner.StorageUsed + fileSize
+		if err := h.userRepo.UpdateStorageUsed(owner.ID, newStorageUsed); err != nil {
+			return nil, err
 		}
+	}
 
+	// Re-read so a concurrent upload of the same content resolves to the
+	// row that won the insert.
+	return h.fileRepo.GetFileContentByHash(sha256Hash)
+}
 
-		newStorageUsed := user.StorageUsed + fileSize
-		if err := h.userRepo.UpdateStorageUsed(userUUID, newStorageUsed); err != nil {
-			c.Error(err)
-			return
-		}
-	} else {
+// releaseOrgStorage undoes an organization charge for content that was not
+// stored after all.
+func (h *FileHandler) releaseOrgStorage(orgID *uuid.UUID, bytes int64) {
+	if orgID != nil {
+		h.orgRepo.ReleaseStorage(*orgID, bytes)
+	}
+}
 
-		fileContent, err = h.fileRepo.GetFileContentByHash(sha256Hash)
-		if err != nil {
-			c.Error(err)
-			return
+// ownedFolderID parses an optional folder ID and checks it is one of
+// userID's personal folders.
+func (h *FileHandler) ownedFolderID(raw string, userID uuid.UUID) (*uuid.UUID, error) {
+	return h.scopedFolderID(raw, userID, nil)
+}
+
+// scopedFolderID parses an optional folder ID and checks it belongs to the
+// scope: userID's personal folders, or the organization's when orgID is
+// set. Membership of the organization is checked by the caller.
+func (h *FileHandler) scopedFolderID(raw string, userID uuid.UUID, orgID *uuid.UUID) (*uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, errors.New(http.StatusBadRequest, "invalid folder id")
+	}
+	folder, err := h.fileRepo.GetFolderByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if orgID == nil {
+		if folder.OrgID != nil || folder.UserID != userID {
+			return nil, errors.ErrForbidden
 		}
+	} else if folder.OrgID == nil || *folder.OrgID != *orgID {
+		return nil, errors.ErrForbidden
 	}
+	return &folder.ID, nil
+}
 
+// orgScope parses an optional organization ID and checks userID is a
+// member. It returns nil for the personal scope.
+func (h *FileHandler) orgScope(raw string, userID uuid.UUID) (*uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, errors.New(http.StatusBadRequest, "invalid org id")
+	}
+	if _, err := h.orgRepo.GetMember(id, userID); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
 
-	fileRecord := &files.File{
-		ID:            uuid.New(),
-		UserID:        userUUID,
-		FileContentID: fileContent.ID,
-		Name:          req.Name,
-		MimeType:      file.Header.Get("Content-Type"),
-		IsPublic:      req.IsPublic,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+// canAccess decides access to an item created by ownerID. Personal items
+// are the owner's alone. Organization items can be read by every member;
+// managing them takes the creator or an org admin, and in both cases
+// current membership.
+func (h *FileHandler) canAccess(ownerID uuid.UUID, orgID *uuid.UUID, userID uuid.UUID, manage bool) (bool, error) {
+	if orgID == nil {
+		return ownerID == userID, nil
+	}
+	member, err := h.orgRepo.GetMember(*orgID, userID)
+	if err == orgs.ErrNotMember {
+		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
+	return !manage || ownerID == userID || member.AtLeast(orgs.RoleAdmin), nil
+}
 
-	if err := h.fileRepo.CreateFile(fileRecord); err != nil {
-		c.Error(err)
-		return
+// authorizeFile returns ErrForbidden unless userID may read the file, or
+// manage it when manage is set. Public files are readable by anyone.
+func (h *FileHandler) authorizeFile(file *files.File, userID uuid.UUID, manage bool) error {
+	if !manage && file.IsPublic {
+		return nil
 	}
+	ok, err := h.canAccess(file.UserID, file.OrgID, userID, manage)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrForbidden
+	}
+	return nil
+}
 
-	c.JSON(http.StatusCreated, fileRecord)
+// authorizeFolder returns ErrForbidden unless userID may manage the folder.
+func (h *FileHandler) authorizeFolder(folder *files.Folder, userID uuid.UUID) error {
+	ok, err := h.canAccess(folder.UserID, folder.OrgID, userID, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrForbidden
+	}
+	return nil
 }
 
 func (h *FileHandler) CheckDuplicate(c *gin.Context) {
@@ -189,7 +346,14 @@ func (h *FileHandler) List(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userUUID := userID.(uuid.UUID)
 
+	orgID, err := h.orgScope(c.Query("org_id"), userUUID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	query := files.FileListQuery{
+		OrgID:    orgID,
 		Search:   c.Query("search"),
 		MimeType: c.Query("mime_type"),
 		Page:     1,
@@ -206,6 +370,14 @@ func (h *FileHandler) List(c *gin.Context) {
 		public := isPublic == "true"
 		query.IsPublic = &public
 	}
+	if folderID := c.Query("folder_id"); folderID != "" {
+		id, err := uuid.Parse(folderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+			return
+		}
+		query.FolderID = &id
+	}
 
 	fileList, total, err := h.fileRepo.ListFiles(userUUID, query)
 	if err != nil {
@@ -234,16 +406,15 @@ func (h *FileHandler) Get(c *gin.Context) {
 		return
 	}
 
-
 	userID, exists := c.Get("user_id")
-	var userUUID uuid.UUID
-	if exists {
-		userUUID = userID.(uuid.UUID)
-	}
-	if !exists || (file.UserID != userUUID && !file.IsPublic) {
+	if !exists {
 		c.Error(errors.ErrForbidden)
 		return
 	}
+	if err := h.authorizeFile(file, userID.(uuid.UUID), false); err != nil {
+		c.Error(err)
+		return
+	}
 
 	c.JSON(http.StatusOK, file)
 }
@@ -261,13 +432,40 @@ func (h *FileHandler) Download(c *gin.Context) {
 		return
 	}
 
+
 	userID, exists := c.Get("user_id")
 	var userUUID uuid.UUID
 	if exists {
 		userUUID = userID.(uuid.UUID)
 	}
-	if !exists || (file.UserID != userUUID && !file.IsPublic) {
-		c.Error(errors.ErrForbidden)
+	grant, signed := c.Get("signed_grant")
+	if !signed {
+		if !exists {
+			c.Error(errors.ErrForbidden)
+			return
+		}
+		if err := h.authorizeFile(file, userUUID, false); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if signed {
+		if err := limitRange(c.Request, file.Size, grant.(*signedurl.Grant).MaxBytes); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	h.serveFile(c, file, &files.DownloadLog{UserID: userUUID})
+}
+
+// serveFile streams the file's content and records the download, unless it
+// has been taken down. The caller has already authorized the request and
+// fills in who downloaded it.
+func (h *FileHandler) serveFile(c *gin.Context, file *files.File, entry *files.DownloadLog) {
+	if err := h.fileRepo.EnsureAvailable(file.ID); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -277,9 +475,14 @@ func (h *FileHandler) Download(c *gin.Context) {
 		return
 	}
 
-	ipAddress := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
-	h.fileRepo.LogDownload(fileID, userUUID, ipAddress, userAgent)
+	entry.FileID = file.ID
+	entry.IPAddress = c.ClientIP()
+	entry.UserAgent = c.GetHeader("User-Agent")
+	entry.Referrer = c.GetHeader("Referer")
+	if err := h.fileRepo.LogDownload(entry); err != nil {
+		c.Error(err)
+		return
+	}
 
 	c.File(fileContent.StoragePath)
 }
@@ -300,8 +503,8 @@ func (h *FileHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if file.UserID != userUUID {
-		c.Error(errors.ErrForbidden)
+	if err := h.authorizeFile(file, userUUID, true); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -309,7 +512,10 @@ func (h *FileHandler) Delete(c *gin.Context) {
 		c.Error(err)
 		return
 	}
-
+	details := audit.Details{"name": file.Name, "owner_id": file.UserID.String()}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionFileDeleted, audit.TargetFile, fileID.String(), details)) {
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "file deleted"})
 }
@@ -330,36 +536,134 @@ func (h *FileHandler) Share(c *gin.Context) {
 		return
 	}
 
-	if file.UserID != userUUID {
-		c.Error(errors.ErrForbidden)
+	if err := h.authorizeFile(file, userUUID, true); err != nil {
+		c.Error(err)
 		return
 	}
 
-	var req struct {
-		IsPublic  bool       `json:"is_public"`
-		ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	}
+	var req files.CreateShareRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	shareToken := fmt.Sprintf("%s-%s", fileID.String()[:8], uuid.New().String()[:8])
-
-	share := &files.FileShare{
-		ID:         uuid.New(),
-		FileID:     fileID,
-		ShareToken: shareToken,
-		IsPublic:   req.IsPublic,
-		ExpiresAt:  req.ExpiresAt,
-		CreatedAt:  time.Now(),
+	share, err := newShare(userUUID, &req)
+	if err != nil {
+		c.Error(err)
+		return
 	}
+	share.TargetType = files.ShareTargetFile
+	share.FileID = &fileID
 
 	if err := h.fileRepo.CreateShare(share); err != nil {
 		c.Error(err)
 		return
 	}
+	if !h.recordShare(c, audit.ActionShareCreated, share) {
+		return
+	}
 
 	c.JSON(http.StatusCreated, share)
 }
 
+// CreateSignedURL issues a time-limited URL that downloads the file without
+// a Bearer token.
+func (h *FileHandler) CreateSignedURL(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := h.fileRepo.GetFileByID(fileID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.authorizeFile(file, userUUID, false); err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req struct {
+		ExpiresIn int    `json:"expires_in"` // seconds, defaults to one hour
+		BindIP    bool   `json:"bind_ip"`    // bind to the caller's IP
+		ClientIP  string `json:"client_ip"`  // bind to an explicit IP
+		MaxBytes  int64  `json:"max_bytes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := time.Hour
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > h.signer.MaxTTL() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in exceeds maximum lifetime"})
+		return
+	}
+	if req.MaxBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_bytes must be positive"})
+		return
+	}
+
+	opts := signedurl.Options{
+		ExpiresAt: time.Now().Add(ttl),
+		ClientIP:  req.ClientIP,
+		MaxBytes:  req.MaxBytes,
+	}
+	if req.BindIP && opts.ClientIP == "" {
+		opts.ClientIP = c.ClientIP()
+	}
+
+	query := h.signer.Sign(fileID, opts)
+	c.JSON(http.StatusCreated, gin.H{
+		"url":        fmt.Sprintf("/api/v1/files/%s/download?%s", fileID, query.Encode()),
+		"expires_at": opts.ExpiresAt.UTC().Truncate(time.Second),
+		"client_ip":  opts.ClientIP,
+		"max_bytes":  opts.MaxBytes,
+	})
+}
+
+// limitRange restricts a request to the first maxBytes bytes of a file. A
+// request without a Range header is narrowed to the permitted prefix; a Range
+// reaching past it is rejected.
+func limitRange(r *http.Request, size, maxBytes int64) error {
+	if maxBytes <= 0 || maxBytes >= size {
+		return nil
+	}
+
+	header := r.Header.Get("Range")
+	if header == "" {
+		r.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxBytes-1))
+		return nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return errRangeNotAllowed
+	}
+	for _, part := range strings.Split(spec, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(part), "-")
+		// suffix and open-ended ranges both reach the end of the file
+		if !ok || start == "" || end == "" {
+			return errRangeNotAllowed
+		}
+		last, err := strconv.ParseInt(end, 10, 64)
+		if err != nil {
+			return errRangeNotAllowed
+		}
+		if last >= maxBytes {
+			return errRangeNotAllowed
+		}
+	}
+	return nil
+}
+
+var errRangeNotAllowed = errors.New(http.StatusRequestedRangeNotSatisfiable, "requested range exceeds signed url limit")
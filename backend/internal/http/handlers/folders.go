@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+var errInvalidFolderName = errors.New(http.StatusBadRequest, `folder name must not contain "/", "\", ".." or control characters`)
+
+// validFolderName rejects names that could act as paths when folders are
+// turned into directories, as in ZIP downloads of a shared folder.
+func validFolderName(name string) bool {
+	if strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *FileHandler) CreateFolder(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		ParentID string `json:"parent_id"`
+		OrgID    string `json:"org_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validFolderName(req.Name) {
+		c.Error(errInvalidFolderName)
+		return
+	}
+
+	orgID, err := h.orgScope(req.OrgID, userUUID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	parentID, err := h.scopedFolderID(req.ParentID, userUUID, orgID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	folder := &files.Folder{
+		ID:        uuid.New(),
+		UserID:    userUUID,
+		OrgID:     orgID,
+		ParentID:  parentID,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := h.fileRepo.CreateFolder(folder); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+func (h *FileHandler) ListFolders(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	orgID, err := h.orgScope(c.Query("org_id"), userUUID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	parentID, err := h.scopedFolderID(c.Query("parent_id"), userUUID, orgID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	folders, err := h.fileRepo.ListFolders(userUUID, orgID, parentID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
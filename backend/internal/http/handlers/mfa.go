@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+)
+
+// contextUser returns the authenticated user as set by the auth middleware.
+func contextUser(c *gin.Context) *users.User {
+	userID, _ := c.Get("user_id")
+	email, _ := c.Get("user_email")
+	role, _ := c.Get("user_role")
+	return &users.User{ID: userID.(uuid.UUID), Email: email.(string), Role: role.(string)}
+}
+
+func (h *AuthHandler) MFAStatus(c *gin.Context) {
+	status, err := h.mfaService.Status(contextUser(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(contextUser(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *AuthHandler) EnableMFA(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	var req auth.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	resp, err := h.authService.EnableMFA(claims.(*auth.Claims), req.Code, clientInfo(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	user := contextUser(c)
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionMFAEnabled, audit.TargetUser, user.ID.String(), nil)) {
+		return
+	}
+	if resp.Auth != nil && !recordLogin(c, h.auditRepo, &resp.Auth.User, "mfa") {
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	var req auth.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := contextUser(c)
+	if err := h.mfaService.Disable(user, req.Code); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionMFADisabled, audit.TargetUser, user.ID.String(), nil)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "mfa disabled"})
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	var req auth.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(contextUser(c).ID, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyMFA is the second step of a login for users with MFA.
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req auth.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provide either code or recovery_code"})
+		return
+	}
+
+	resp, err := h.authService.VerifyMFA(&req, clientInfo(c))
+	if err != nil {
+		if recordLoginFailure(c, h.auditRepo, err, audit.Details{"method": "mfa"}) {
+			c.Error(err)
+		}
+		return
+	}
+	if !recordLogin(c, h.auditRepo, &resp.User, "mfa") {
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+)
+
+const (
+	oidcBindingCookie = "oidc_binding"
+	oidcCookiePath    = "/api/v1/auth/oidc"
+)
+
+type OIDCHandler struct {
+	oidc            *auth.OIDCService
+	auditRepo       *audit.Repository
+	successRedirect string
+}
+
+func NewOIDCHandler(oidcService *auth.OIDCService, auditRepo *audit.Repository, successRedirect string) *OIDCHandler {
+	return &OIDCHandler{oidc: oidcService, auditRepo: auditRepo, successRedirect: successRedirect}
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	login, err := h.oidc.Start(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Lax so the cookie survives the top-level redirect back from the
+	// provider.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, login.Binding, int(auth.OIDCStateTTL.Seconds()), oidcCookiePath, "", isHTTPS(c), true)
+	c.Redirect(http.StatusFound, login.URL)
+}
+
+// Callback completes the login. Tokens, or an MFA challenge, are returned
+// as JSON, or handed to the frontend in the URL fragment when a success
+// redirect is configured.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider denied login", "reason": reason})
+		return
+	}
+
+	code := c.Query("code")
+	state := c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	binding, _ := c.Cookie(oidcBindingCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, "", -1, oidcCookiePath, "", isHTTPS(c), true)
+
+	resp, challenge, err := h.oidc.Complete(c.Request.Context(), code, state, binding, clientInfo(c))
+	if err != nil {
+		if recordLoginFailure(c, h.auditRepo, err, audit.Details{"method": "oidc"}) {
+			c.Error(err)
+		}
+		return
+	}
+	if challenge == nil && !recordLogin(c, h.auditRepo, &resp.User, "oidc") {
+		return
+	}
+
+	if h.successRedirect == "" {
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	fragment := url.Values{}
+	if challenge != nil {
+		fragment.Set("mfa_token", challenge.MFAToken)
+		fragment.Set("mfa_enrollment_required", strconv.FormatBool(challenge.EnrollmentRequired))
+		fragment.Set("expires_at", challenge.ExpiresAt.Format(time.RFC3339))
+	} else {
+		fragment.Set("token", resp.Token)
+		fragment.Set("expires_at", resp.ExpiresAt.Format(time.RFC3339))
+		fragment.Set("refresh_token", resp.RefreshToken)
+	}
+	c.Redirect(http.StatusFound, h.successRedirect+"#"+fragment.Encode())
+}
+
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
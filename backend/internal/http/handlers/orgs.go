@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/orgs"
+	"github.com/samridh-111/balkan_task/internal/core/users"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+// OrgHandler handles organizations and their members. What a caller may do
+// depends on their role in the organization: members can browse, admins
+// manage members, and owners can grant ownership or delete the org.
+type OrgHandler struct {
+	orgRepo   *orgs.Repository
+	userRepo  *users.Repository
+	auditRepo *audit.Repository
+}
+
+func NewOrgHandler(orgRepo *orgs.Repository, userRepo *users.Repository, auditRepo *audit.Repository) *OrgHandler {
+	return &OrgHandler{orgRepo: orgRepo, userRepo: userRepo, auditRepo: auditRepo}
+}
+
+// recordMemberChange audits a change to a member of the organization. The
+// member is the target, so the change shows in their own audit trail.
+func (h *OrgHandler) recordMemberChange(c *gin.Context, action string, orgID, userID uuid.UUID, details audit.Details) bool {
+	details["org_id"] = orgID.String()
+	return recordAudit(c, h.auditRepo, auditEvent(c, action, audit.TargetUser, userID.String(), details))
+}
+
+// membership parses the :id parameter and returns the caller's membership,
+// failing with ErrForbidden unless their role is at least role.
+func (h *OrgHandler) membership(c *gin.Context, role string) (*orgs.Member, bool) {
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid org id"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	member, err := h.orgRepo.GetMember(orgID, userID.(uuid.UUID))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	if !member.AtLeast(role) {
+		c.Error(errors.ErrForbidden)
+		return nil, false
+	}
+	return member, true
+}
+
+func (h *OrgHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req orgs.CreateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	org := &orgs.Organization{
+		ID:           uuid.New(),
+		Name:         req.Name,
+		StorageQuota: orgs.DefaultStorageQuota,
+		CreatedBy:    userID.(uuid.UUID),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Role:         orgs.RoleOwner,
+	}
+	if err := h.orgRepo.Create(org); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// List returns the organizations the caller belongs to
+func (h *OrgHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	list, err := h.orgRepo.ListForUser(userID.(uuid.UUID))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": list})
+}
+
+func (h *OrgHandler) Get(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleMember)
+	if !ok {
+		return
+	}
+
+	org, err := h.orgRepo.GetByID(member.OrgID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	org.Role = member.Role
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *OrgHandler) Update(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req orgs.UpdateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.orgRepo.Rename(member.OrgID, req.Name); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "organization updated"})
+}
+
+// Delete removes an organization once it no longer owns any files
+func (h *OrgHandler) Delete(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := h.orgRepo.Delete(member.OrgID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "organization deleted"})
+}
+
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleMember)
+	if !ok {
+		return
+	}
+
+	members, err := h.orgRepo.ListMembers(member.OrgID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddMember adds an existing user by email. Only owners can add owners.
+func (h *OrgHandler) AddMember(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req orgs.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = orgs.RoleMember
+	}
+	if !h.canGrant(c, member, req.Role) {
+		return
+	}
+
+	user, err := h.userRepo.GetByEmail(strings.ToLower(req.Email))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	added := &orgs.Member{
+		OrgID:     member.OrgID,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      req.Role,
+		CreatedAt: time.Now(),
+	}
+	if err := h.orgRepo.AddMember(added); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordMemberChange(c, audit.ActionOrgMemberAdded, member.OrgID, user.ID, audit.Details{"role": req.Role}) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, added)
+}
+
+// UpdateMember changes a member's role. Admins cannot change owners, and
+// only owners can make someone an owner.
+func (h *OrgHandler) UpdateMember(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleAdmin)
+	if !ok {
+		return
+	}
+	target, ok := h.targetMember(c, member)
+	if !ok {
+		return
+	}
+
+	var req orgs.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.canGrant(c, member, req.Role) || !h.canManage(c, member, target) {
+		return
+	}
+
+	if err := h.orgRepo.SetMemberRole(member.OrgID, target.UserID, req.Role); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordMemberChange(c, audit.ActionOrgMemberRoleChanged, member.OrgID, target.UserID, audit.Details{"from": target.Role, "to": req.Role}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member updated"})
+}
+
+// RemoveMember takes a member out of the organization. Admins can remove
+// members and admins, and anyone can leave.
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	member, ok := h.membership(c, orgs.RoleMember)
+	if !ok {
+		return
+	}
+	target, ok := h.targetMember(c, member)
+	if !ok {
+		return
+	}
+	if target.UserID != member.UserID {
+		if !member.AtLeast(orgs.RoleAdmin) {
+			c.Error(errors.ErrForbidden)
+			return
+		}
+		if !h.canManage(c, member, target) {
+			return
+		}
+	}
+
+	if err := h.orgRepo.RemoveMember(member.OrgID, target.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordMemberChange(c, audit.ActionOrgMemberRemoved, member.OrgID, target.UserID, audit.Details{"role": target.Role}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+// targetMember loads the member named by the :user_id parameter.
+func (h *OrgHandler) targetMember(c *gin.Context, member *orgs.Member) (*orgs.Member, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return nil, false
+	}
+
+	target, err := h.orgRepo.GetMember(member.OrgID, userID)
+	if err == orgs.ErrNotMember {
+		c.Error(errors.ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return target, true
+}
+
+// canGrant checks role is valid and the member may hand it out.
+func (h *OrgHandler) canGrant(c *gin.Context, member *orgs.Member, role string) bool {
+	if !orgs.ValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, admin or member"})
+		return false
+	}
+	if role == orgs.RoleOwner && !member.AtLeast(orgs.RoleOwner) {
+		c.Error(errors.New(http.StatusForbidden, "only owners can grant ownership"))
+		return false
+	}
+	return true
+}
+
+// canManage checks the member may change target: only owners can change
+// other owners.
+func (h *OrgHandler) canManage(c *gin.Context, member, target *orgs.Member) bool {
+	if target.Role == orgs.RoleOwner && !member.AtLeast(orgs.RoleOwner) {
+		c.Error(errors.New(http.StatusForbidden, "only owners can change owners"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+)
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	sessions, err := h.authService.ListSessions(claims.(*auth.Claims))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs out one session. Revoking the current session is the
+// same as logging out.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	if err := h.authService.RevokeSession(claims.(*auth.Claims), id); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionSessionRevoked, audit.TargetSession, id.String(), nil)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// RevokeOtherSessions signs out every session except the current one.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	if !requireLoginSession(c) {
+		return
+	}
+
+	claims, _ := c.Get("claims")
+	if err := h.authService.RevokeOtherSessions(claims.(*auth.Claims)); err != nil {
+		c.Error(err)
+		return
+	}
+	if !recordAudit(c, h.auditRepo, auditEvent(c, audit.ActionSessionRevoked, audit.TargetSession, "", audit.Details{"all_except": claims.(*auth.Claims).SessionID.String()})) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "other sessions revoked"})
+}
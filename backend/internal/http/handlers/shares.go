@@ -0,0 +1,659 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
+	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/files"
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+	"github.com/samridh-111/balkan_task/internal/pkg/token"
+)
+
+var (
+	errShareExpired          = errors.New(http.StatusGone, "share link expired")
+	errSharePasswordRequired = errors.New(http.StatusUnauthorized, "share password required")
+	errSharePasswordInvalid  = errors.New(http.StatusForbidden, "invalid share password")
+)
+
+// CreateShare shares a folder (including everything below it) or an ad-hoc
+// collection of files. Single files are shared through POST /files/:id/share.
+func (h *FileHandler) CreateShare(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	var req files.CreateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch req.TargetType {
+	case files.ShareTargetFolder:
+		if req.FolderID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "folder_id is required"})
+			return
+		}
+		folder, err := h.fileRepo.GetFolderByID(*req.FolderID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if err := h.authorizeFolder(folder, userUUID); err != nil {
+			c.Error(err)
+			return
+		}
+	case files.ShareTargetCollection:
+		if len(req.FileIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids is required"})
+			return
+		}
+		for _, fileID := range req.FileIDs {
+			file, err := h.fileRepo.GetFileByID(fileID)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			if err := h.authorizeFile(file, userUUID, true); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_type must be folder or collection"})
+		return
+	}
+
+	share, err := newShare(userUUID, &req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	share.TargetType = req.TargetType
+	if req.TargetType == files.ShareTargetFolder {
+		share.FolderID = req.FolderID
+	} else {
+		share.FileIDs = req.FileIDs
+	}
+
+	if err := h.fileRepo.CreateShare(share); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordShare(c, audit.ActionShareCreated, share) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// newShare builds the parts of a share common to every target type.
+func newShare(userID uuid.UUID, req *files.CreateShareRequest) (*files.FileShare, error) {
+	if req.ValidFrom != nil && req.ExpiresAt != nil && !req.ValidFrom.Before(*req.ExpiresAt) {
+		return nil, errors.New(http.StatusBadRequest, "valid_from must be before expires_at")
+	}
+
+	share := &files.FileShare{
+		ID:         uuid.New(),
+		UserID:     userID,
+		ShareToken: token.New(24),
+		IsPublic:   req.IsPublic,
+		ValidFrom:  req.ValidFrom,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return nil, errors.Wrap(500, "failed to hash share password", err)
+		}
+		share.PasswordHash = hash
+		share.PasswordProtected = true
+	}
+	return share, nil
+}
+
+// RevokeShare deletes a share link. Its past downloads stay in the owner's
+// file analytics.
+func (h *FileHandler) RevokeShare(c *gin.Context) {
+	share, ok := h.ownedShare(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileRepo.DeleteShare(share.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.recordShare(c, audit.ActionShareRevoked, share) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "share revoked"})
+}
+
+// recordShare audits the creation or revocation of a share link.
+func (h *FileHandler) recordShare(c *gin.Context, action string, share *files.FileShare) bool {
+	details := audit.Details{
+		"target_type":        share.TargetType,
+		"is_public":          share.IsPublic,
+		"password_protected": share.PasswordProtected,
+	}
+	switch {
+	case share.FileID != nil:
+		details["file_id"] = share.FileID.String()
+	case share.FolderID != nil:
+		details["folder_id"] = share.FolderID.String()
+	}
+	if share.ExpiresAt != nil {
+		details["expires_at"] = share.ExpiresAt
+	}
+	return recordAudit(c, h.auditRepo, auditEvent(c, action, audit.TargetShare, share.ID.String(), details))
+}
+
+// ViewShare resolves a share link and records the visit for the owner's
+// analytics. A file share returns the file's metadata; folder and collection
+// shares return a listing. Folder shares can be browsed with ?folder_id=.
+func (h *FileHandler) ViewShare(c *gin.Context) {
+	share, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	view := &files.ShareView{
+		ShareID:   share.ID,
+		UserID:    currentUserID(c),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Referrer:  c.GetHeader("Referer"),
+	}
+
+	response := gin.H{
+		"target_type": share.TargetType,
+		"expires_at":  share.ExpiresAt,
+	}
+
+	switch share.TargetType {
+	case files.ShareTargetFile:
+		file, err := h.fileRepo.GetFileByID(*share.FileID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if err := h.fileRepo.EnsureAvailable(file.ID); err != nil {
+			c.Error(err)
+			return
+		}
+		view.FileID = file.ID
+		response["name"] = file.Name
+		response["mime_type"] = file.MimeType
+		response["size"] = file.Size
+	case files.ShareTargetCollection:
+		items, err := h.fileRepo.ListShareItems(share.ID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		response["files"] = sharedFileListing(items)
+	case files.ShareTargetFolder:
+		folderID := *share.FolderID
+		if raw := c.Query("folder_id"); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+				return
+			}
+			inside, err := h.fileRepo.FolderInSubtree(folderID, id)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			if !inside {
+				c.Error(errors.ErrNotFound)
+				return
+			}
+			folderID = id
+		}
+
+		folder, err := h.fileRepo.GetFolderByID(folderID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		subfolders, err := h.fileRepo.ListFolders(share.UserID, folder.OrgID, &folderID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		items, err := h.fileRepo.ListFolderFiles(folderID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		folderListing := make([]gin.H, len(subfolders))
+		for i, sub := range subfolders {
+			folderListing[i] = gin.H{"id": sub.ID, "name": sub.Name}
+		}
+		response["folder"] = gin.H{"id": folder.ID, "name": folder.Name}
+		response["folders"] = folderListing
+		response["files"] = sharedFileListing(items)
+	}
+
+	if err := h.fileRepo.LogShareView(view); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadShare downloads the file behind a single-file share link.
+func (h *FileHandler) DownloadShare(c *gin.Context) {
+	share, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	if share.TargetType != files.ShareTargetFile {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "share contains several files, download them individually or as zip"})
+		return
+	}
+
+	file, err := h.fileRepo.GetFileByID(*share.FileID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.serveFile(c, file, &files.DownloadLog{UserID: currentUserID(c), ShareID: &share.ID})
+}
+
+// DownloadShareItem downloads one file reachable through a share.
+func (h *FileHandler) DownloadShareItem(c *gin.Context) {
+	share, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	fileID, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := h.fileRepo.GetFileByID(fileID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reachable, err := h.fileRepo.ShareContainsFile(share, file)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !reachable {
+		c.Error(errors.ErrNotFound)
+		return
+	}
+
+	h.serveFile(c, file, &files.DownloadLog{UserID: currentUserID(c), ShareID: &share.ID})
+}
+
+// DownloadShareZip streams every file reachable through a share as a ZIP
+// archive. Each file is recorded as a download.
+func (h *FileHandler) DownloadShareZip(c *gin.Context) {
+	share, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.fileRepo.ListShareArchiveEntries(share)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, share.ShareToken))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+
+	seen := map[string]int{}
+	for _, entry := range entries {
+		fileContent, err := h.fileRepo.GetFileContentByID(entry.File.FileContentID)
+		if err != nil {
+			// Headers are already sent; stop and leave a truncated archive.
+			c.Error(err)
+			return
+		}
+
+		if err := addToArchive(archive, uniqueArchivePath(seen, archivePath(entry.Path)), fileContent.StoragePath, entry.File.UpdatedAt); err != nil {
+			c.Error(err)
+			return
+		}
+
+		err = h.fileRepo.LogDownload(&files.DownloadLog{
+			FileID:    entry.File.ID,
+			UserID:    currentUserID(c),
+			ShareID:   &share.ID,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			Referrer:  c.GetHeader("Referer"),
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+}
+
+func addToArchive(archive *zip.Writer, name, storagePath string, modified time.Time) error {
+	src, err := os.Open(storagePath)
+	if err != nil {
+		return errors.Wrap(500, "failed to open file", err)
+	}
+	defer src.Close()
+
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return errors.Wrap(500, "failed to write archive", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return errors.Wrap(500, "failed to write archive", err)
+	}
+	return nil
+}
+
+// archivePath makes a file's path safe to extract: backslashes become
+// slashes, and the path is cleaned so it cannot be absolute or climb out
+// of the extraction directory with "..".
+func archivePath(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimLeft(name, "/")
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
+
+// uniqueArchivePath disambiguates files that share a name, since a folder
+// may hold several files with the same name.
+func uniqueArchivePath(seen map[string]int, path string) string {
+	n := seen[path]
+	seen[path] = n + 1
+	if n == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+func sharedFileListing(items []*files.File) []gin.H {
+	listing := make([]gin.H, len(items))
+	for i, file := range items {
+		listing[i] = gin.H{
+			"id":         file.ID,
+			"name":       file.Name,
+			"mime_type":  file.MimeType,
+			"size":       file.Size,
+			"updated_at": file.UpdatedAt,
+		}
+	}
+	return listing
+}
+
+// ListShares returns the caller's share links with view and download totals.
+// ?status=upcoming lists only embargoed shares that are not yet active,
+// soonest first.
+func (h *FileHandler) ListShares(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	query := files.ShareListQuery{UpcomingOnly: c.Query("status") == "upcoming"}
+	shares, err := h.fileRepo.ListSharesByUser(userUUID, query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+// ShareAnalytics returns daily views and downloads, unique visitors and top
+// referrers and user agents for one of the caller's shares.
+func (h *FileHandler) ShareAnalytics(c *gin.Context) {
+	share, ok := h.ownedShare(c)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseRange(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	stats, err := h.fileRepo.GetAccessStats(files.AccessQuery{ShareID: &share.ID, From: from, To: to})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// ShareAccesses lists who viewed or downloaded one of the caller's shares.
+func (h *FileHandler) ShareAccesses(c *gin.Context) {
+	share, ok := h.ownedShare(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	entries, total, err := h.fileRepo.ListShareAccesses(share.ID, page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accesses":  entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// FileAnalytics aggregates access to one of the caller's files across direct
+// downloads and every share link pointing at it.
+func (h *FileHandler) FileAnalytics(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userUUID := userID.(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := h.fileRepo.GetFileByID(fileID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.authorizeFile(file, userUUID, true); err != nil {
+		c.Error(err)
+		return
+	}
+
+	from, to, err := parseRange(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	stats, err := h.fileRepo.GetAccessStats(files.AccessQuery{FileID: &file.ID, From: from, To: to})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// resolveShare loads the share named by the :token parameter, enforcing
+// the activation window and password and requiring a signed-in user for non-public shares.
+// The rules apply to every item reachable through the share. It writes the
+// error response itself.
+func (h *FileHandler) resolveShare(c *gin.Context) (*files.FileShare, bool) {
+	share, err := h.fileRepo.GetShareByToken(c.Param("token"))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	now := time.Now()
+	if share.ValidFrom != nil && now.Before(*share.ValidFrom) {
+		// Embargoed: distinct from expired or missing so clients can show a
+		// countdown instead of an error.
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":        "share not yet available",
+			"available_at": share.ValidFrom,
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	if share.ExpiresAt != nil && now.After(*share.ExpiresAt) {
+		c.Error(errShareExpired)
+		return nil, false
+	}
+
+	if !share.IsPublic && currentUserID(c) == uuid.Nil {
+		c.Error(errors.ErrUnauthorized)
+		return nil, false
+	}
+
+	if share.PasswordProtected {
+		// Only from the header: a query string ends up in access logs,
+		// browser history and Referer headers.
+		password := c.GetHeader("X-Share-Password")
+		if password == "" {
+			c.Error(errSharePasswordRequired)
+			return nil, false
+		}
+		wait, err := h.fileRepo.ReserveSharePasswordAttempt(share.ID)
+		if err != nil {
+			c.Error(err)
+			return nil, false
+		}
+		if wait > 0 {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong share passwords", "retry_after": retryAfter})
+			c.Abort()
+			return nil, false
+		}
+		if !auth.CheckPasswordHash(password, share.PasswordHash) {
+			c.Error(errSharePasswordInvalid)
+			return nil, false
+		}
+		if err := h.fileRepo.ClearSharePasswordFailures(share.ID); err != nil {
+			c.Error(err)
+			return nil, false
+		}
+	}
+
+	return share, true
+}
+
+// ownedShare loads the share named by the :id parameter and checks the caller
+// owns the shared file. It writes the error response itself.
+func (h *FileHandler) ownedShare(c *gin.Context) (*files.FileShare, bool) {
+	shareID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+		return nil, false
+	}
+
+	share, err := h.fileRepo.GetShareByID(shareID)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	if share.UserID != currentUserID(c) {
+		c.Error(errors.ErrForbidden)
+		return nil, false
+	}
+
+	return share, true
+}
+
+// currentUserID returns the authenticated user, or uuid.Nil for anonymous
+// requests.
+func currentUserID(c *gin.Context) uuid.UUID {
+	if userID, exists := c.Get("user_id"); exists {
+		return userID.(uuid.UUID)
+	}
+	return uuid.Nil
+}
+
+// parseRange reads the from/to query parameters as dates (YYYY-MM-DD, to is
+// inclusive) or RFC 3339 timestamps. It defaults to the last 30 days.
+func parseRange(c *gin.Context) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+
+	if raw := c.Query("from"); raw != "" {
+		t, _, err := parseDateOrTime(raw)
+		if err != nil {
+			return from, to, errors.New(http.StatusBadRequest, "invalid from")
+		}
+		from = t
+	}
+	if raw := c.Query("to"); raw != "" {
+		t, dateOnly, err := parseDateOrTime(raw)
+		if err != nil {
+			return from, to, errors.New(http.StatusBadRequest, "invalid to")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	if !from.Before(to) {
+		return from, to, errors.New(http.StatusBadRequest, "from must be before to")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return from, to, errors.New(http.StatusBadRequest, "range may not exceed one year")
+	}
+	return from, to, nil
+}
+
+func parseDateOrTime(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t.UTC(), false, err
+}
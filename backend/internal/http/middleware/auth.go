@@ -5,11 +5,28 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/samridh-111/balkan_task/internal/core/audit"
 	"github.com/samridh-111/balkan_task/internal/core/auth"
+	"github.com/samridh-111/balkan_task/internal/core/rbac"
+	"github.com/samridh-111/balkan_task/internal/core/signedurl"
 	"github.com/samridh-111/balkan_task/internal/pkg/errors"
 )
 
-func AuthMiddleware(jwtService *auth.Service) gin.HandlerFunc {
+// AuthMiddleware authenticates the Bearer token. Every request made with an
+// impersonation token is recorded in auditRepo before it is handled.
+func AuthMiddleware(authService *auth.AuthService, auditRepo *audit.Repository) gin.HandlerFunc {
+	return bearerAuth(authService.Authenticate, auditRepo)
+}
+
+// MFAEnrollmentAuth is AuthMiddleware that also accepts the enrollment
+// token given to users who must set up MFA before they can sign in.
+// Impersonation tokens are refused.
+func MFAEnrollmentAuth(authService *auth.AuthService) gin.HandlerFunc {
+	return bearerAuth(authService.AuthenticateMFAEnrollment, nil)
+}
+
+func bearerAuth(authenticate func(string) (*auth.Claims, error), auditRepo *audit.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,16 +42,89 @@ func AuthMiddleware(jwtService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := jwtService.ValidateToken(parts[1])
+		claims, err := authenticate(parts[1])
+		if err == auth.ErrTokenRevoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			c.Abort()
+			return
+		}
+		if err == auth.ErrAccountSuspended {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account suspended"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		if claims.Impersonated() {
+			if auditRepo == nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrImpersonationNotAllowed.Message})
+				c.Abort()
+				return
+			}
+			if !recordImpersonated(c, auditRepo, claims) {
+				c.Abort()
+				return
+			}
+		}
+
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// setClaims exposes the authenticated user to handlers. Impersonation
+// tokens also expose the admin acting as the user, and the response says
+// who it is.
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_role", claims.Role)
+	c.Set("claims", claims)
+	if claims.Act != nil {
+		c.Set("impersonator_id", claims.Act.UserID)
+		c.Set("impersonator_email", claims.Act.Email)
+		c.Header("X-Impersonated-By", claims.Act.Email)
+	}
+}
+
+// recordImpersonated audits a request made with an impersonation token,
+// attributed to the admin. The request fails if it cannot be recorded.
+func recordImpersonated(c *gin.Context, auditRepo *audit.Repository, claims *auth.Claims) bool {
+	actorID := claims.Act.UserID
+	err := auditRepo.Record(&audit.Event{
+		ActorID:    &actorID,
+		Action:     audit.ActionImpersonatedRequest,
+		TargetType: audit.TargetUser,
+		TargetID:   claims.UserID.String(),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		RequestID:  c.GetString("request_id"),
+		Details: audit.Details{
+			"method":       c.Request.Method,
+			"path":         c.Request.URL.Path,
+			"allow_writes": claims.Act.AllowWrites,
+		},
+	})
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
+
+// DenyImpersonation rejects impersonation tokens on routes that change how
+// an account is secured, such as passwords, MFA and API keys.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("impersonator_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrImpersonationNotAllowed.Message})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -54,3 +144,87 @@ func ErrorHandler() gin.HandlerFunc {
 	}
 }
 
+// SignedURLOrAuth authorizes a request either by a signed URL in the query
+// string or, when no signature is present, by the usual Bearer token. A
+// verified signed URL is exposed to handlers as "signed_grant".
+func SignedURLOrAuth(signer *signedurl.Signer, authService *auth.AuthService, auditRepo *audit.Repository) gin.HandlerFunc {
+	requireAuth := AuthMiddleware(authService, auditRepo)
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if query.Get(signedurl.ParamSig) == "" {
+			requireAuth(c)
+			return
+		}
+
+		fileID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+			c.Abort()
+			return
+		}
+
+		grant, err := signer.Verify(fileID, query, c.ClientIP())
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Set("signed_grant", grant)
+		c.Next()
+	}
+}
+
+// OptionalAuth identifies the user when a valid Bearer token is present but
+// lets anonymous requests through, for endpoints such as share links that
+// serve both.
+func OptionalAuth(authService *auth.AuthService, auditRepo *audit.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			if claims, err := authService.Authenticate(parts[1]); err == nil {
+				if claims.Impersonated() && !recordImpersonated(c, auditRepo, claims) {
+					c.Abort()
+					return
+				}
+				setClaims(c, claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission rejects requests whose authenticated role does not grant
+// perm, or whose API key was not given perm as a scope. Impersonation
+// tokens only get write permissions when the admin asked for them. It must run after
+// AuthMiddleware. Requests authorized by a signed URL carry their own grant
+// and are let through.
+func RequirePermission(perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("signed_grant"); ok {
+			c.Next()
+			return
+		}
+
+		role, _ := c.Get("user_role")
+		roleName, _ := role.(string)
+		if !rbac.HasPermission(roleName, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied", "required": perm})
+			c.Abort()
+			return
+		}
+
+		if value, ok := c.Get("claims"); ok {
+			if claims, ok := value.(*auth.Claims); ok && !claims.AllowsScope(string(perm)) {
+				message := "api key scope missing"
+				if claims.Impersonated() {
+					message = auth.ErrImpersonationNotAllowed.Message
+				}
+				c.JSON(http.StatusForbidden, gin.H{"error": message, "required": perm})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// A client or proxy supplied request ID is kept if it looks like an ID;
+// anything else is replaced so it cannot pollute logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,100}$`)
+
+// RequestID tags every request with an ID, taken from X-Request-ID when
+// the client sent a usable one and generated otherwise. The ID is echoed in
+// the response and stored in the context as "request_id" so audit events
+// can be matched to requests.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
@@ -0,0 +1,238 @@
+// Package hashchain makes append-only tables tamper-evident. Each record
+// stores the SHA-256 of the previous record's hash followed by its own
+// canonical contents, so editing, deleting or reordering any record breaks
+// every hash after it.
+package hashchain
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Link is a record's place in a chain. The first record has Seq 1 and an
+// empty PrevHash.
+type Link struct {
+	Seq      int64  `json:"seq"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// Hash returns the hash of a record with the given canonical fields that
+// follows prevHash. Fields are length-prefixed so that moving bytes from
+// one field to the next changes the hash.
+func Hash(prevHash string, fields ...string) string {
+	h := sha256.New()
+	for _, f := range append([]string{prevHash}, fields...) {
+		h.Write([]byte(strconv.Itoa(len(f))))
+		h.Write([]byte{':'})
+		h.Write([]byte(f))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Next returns the link for a record appended after head, which is nil for
+// an empty chain. The sequence number is hashed along with fields.
+func Next(head *Link, fields ...string) Link {
+	next := Link{Seq: 1}
+	if head != nil {
+		next = Link{Seq: head.Seq + 1, PrevHash: head.Hash}
+	}
+	next.Hash = Hash(next.PrevHash, append([]string{strconv.FormatInt(next.Seq, 10)}, fields...)...)
+	return next
+}
+
+// Lock serializes appends to a chain until tx ends, so two writers cannot
+// both extend the same head.
+func Lock(tx *sql.Tx, chain string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "hashchain:"+chain)
+	return err
+}
+
+// Time formats a timestamp as stored in a TIMESTAMP column: wall clock to
+// the microsecond, without a zone. Callers must truncate times to the
+// microsecond before storing them so the stored value hashes the same.
+func Time(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000000")
+}
+
+// CanonicalJSON re-encodes a JSON document with sorted keys and no
+// insignificant whitespace, which is how it hashes whether it came from Go
+// or back out of a JSONB column.
+func CanonicalJSON(raw []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Head returns the last linked record of a chained table, or nil if there
+// is none. Chained tables have seq, prev_hash and hash columns.
+func Head(q Querier, table string) (*Link, error) {
+	head := &Link{}
+	err := q.QueryRow(`SELECT seq, prev_hash, hash FROM `+table+` WHERE seq IS NOT NULL ORDER BY seq DESC LIMIT 1`).
+		Scan(&head.Seq, &head.PrevHash, &head.Hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// Execer is satisfied by both *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// SaveCheckpoint records link as a checkpoint of chain. A checkpoint also
+// vouches for records before it that were deliberately removed.
+func SaveCheckpoint(e Execer, chain string, link *Link, now time.Time) error {
+	query := `INSERT INTO log_checkpoints (id, chain, seq, hash, created_at) VALUES (gen_random_uuid(), $1, $2, $3, $4)`
+	_, err := e.Exec(query, chain, link.Seq, link.Hash, now)
+	return err
+}
+
+// Record is a stored record as read back for verification.
+type Record struct {
+	ID     string
+	Link   Link
+	Fields []string
+}
+
+// Checkpoint is a chain head saved at some point in time. A later head
+// must still contain it.
+type Checkpoint struct {
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Problem is one inconsistency found while verifying.
+type Problem struct {
+	Seq      int64  `json:"seq"`
+	RecordID string `json:"record_id,omitempty"`
+	Issue    string `json:"issue"`
+}
+
+// maxProblems bounds a report; past it the chain is clearly compromised.
+const maxProblems = 100
+
+// Verifier checks records fed to it in sequence order.
+type Verifier struct {
+	checkpoints map[int64]Checkpoint
+	last        *Link
+	records     int64
+	problems    []Problem
+	truncated   bool
+}
+
+// NewVerifier starts a verification against the chain's checkpoints.
+func NewVerifier(checkpoints []Checkpoint) *Verifier {
+	v := &Verifier{checkpoints: map[int64]Checkpoint{}}
+	for _, cp := range checkpoints {
+		v.checkpoints[cp.Seq] = cp
+	}
+	return v
+}
+
+func (v *Verifier) report(seq int64, id, format string, args ...interface{}) {
+	if len(v.problems) >= maxProblems {
+		v.truncated = true
+		return
+	}
+	v.problems = append(v.problems, Problem{Seq: seq, RecordID: id, Issue: fmt.Sprintf(format, args...)})
+}
+
+// Add checks the next record: its contents against its hash, its link to
+// the record before it, and any checkpoint taken at its position.
+func (v *Verifier) Add(r Record) {
+	v.records++
+	seq := r.Link.Seq
+
+	want := Hash(r.Link.PrevHash, append([]string{strconv.FormatInt(seq, 10)}, r.Fields...)...)
+	if want != r.Link.Hash {
+		v.report(seq, r.ID, "contents do not match the stored hash")
+	}
+
+	switch {
+	case v.last == nil && seq != 1:
+		// Rows before this one are gone. That is only legitimate where a
+		// checkpoint vouches for the row this one links to.
+		if cp, ok := v.checkpoints[seq-1]; !ok || cp.Hash != r.Link.PrevHash {
+			v.report(seq, r.ID, "chain starts at seq %d; records 1-%d are missing", seq, seq-1)
+		}
+	case v.last == nil && r.Link.PrevHash != "":
+		v.report(seq, r.ID, "first record links to a previous hash")
+	case v.last != nil && seq != v.last.Seq+1:
+		v.report(seq, r.ID, "sequence jumps from %d to %d; records were deleted or reordered", v.last.Seq, seq)
+	case v.last != nil && r.Link.PrevHash != v.last.Hash:
+		v.report(seq, r.ID, "previous hash does not match record %d", v.last.Seq)
+	}
+
+	if cp, ok := v.checkpoints[seq]; ok && cp.Hash != r.Link.Hash {
+		v.report(seq, r.ID, "hash differs from the checkpoint taken %s", cp.CreatedAt.Format(time.RFC3339))
+	}
+
+	link := r.Link
+	v.last = &link
+}
+
+// Report is the outcome of a verification.
+type Report struct {
+	Records     int64     `json:"records"`
+	Head        *Link     `json:"head"`
+	Checkpoints int       `json:"checkpoints"`
+	Valid       bool      `json:"valid"`
+	Problems    []Problem `json:"problems"`
+	Truncated   bool      `json:"truncated,omitempty"` // more problems than listed
+}
+
+// Finish completes the verification. Checkpoints past the last record mean
+// records were removed from the end of the chain.
+func (v *Verifier) Finish() *Report {
+	var headSeq int64
+	if v.last != nil {
+		headSeq = v.last.Seq
+	}
+	var latest *Checkpoint
+	for _, cp := range v.checkpoints {
+		if cp.Seq > headSeq && (latest == nil || cp.Seq > latest.Seq) {
+			cp := cp
+			latest = &cp
+		}
+	}
+	if latest != nil {
+		v.report(latest.Seq, "", "checkpoint taken %s is past the last record %d; records were removed from the end",
+			latest.CreatedAt.Format(time.RFC3339), headSeq)
+	}
+
+	problems := v.problems
+	if problems == nil {
+		problems = []Problem{}
+	}
+	return &Report{
+		Records:     v.records,
+		Head:        v.last,
+		Checkpoints: len(v.checkpoints),
+		Valid:       len(problems) == 0,
+		Problems:    problems,
+		Truncated:   v.truncated,
+	}
+}
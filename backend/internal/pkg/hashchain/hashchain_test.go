@@ -0,0 +1,136 @@
+package hashchain
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// buildChain links n records whose single field is "record <seq>".
+func buildChain(n int) []Record {
+	var head *Link
+	records := make([]Record, 0, n)
+	for i := 1; i <= n; i++ {
+		fields := []string{"record " + strconv.Itoa(i)}
+		link := Next(head, fields...)
+		head = &link
+		records = append(records, Record{ID: strconv.Itoa(i), Link: link, Fields: fields})
+	}
+	return records
+}
+
+func verify(records []Record, checkpoints ...Checkpoint) *Report {
+	v := NewVerifier(checkpoints)
+	for _, r := range records {
+		v.Add(r)
+	}
+	return v.Finish()
+}
+
+// checkpointAt is the checkpoint SaveCheckpoint would store for r.
+func checkpointAt(r Record) Checkpoint {
+	return Checkpoint{Seq: r.Link.Seq, Hash: r.Link.Hash, CreatedAt: time.Now()}
+}
+
+func TestVerifyIntact(t *testing.T) {
+	chain := buildChain(5)
+	report := verify(chain, checkpointAt(chain[2]), checkpointAt(chain[4]))
+	if !report.Valid {
+		t.Fatalf("intact chain reported invalid: %+v", report.Problems)
+	}
+	if report.Records != 5 || report.Head.Seq != 5 {
+		t.Errorf("records = %d, head = %d; want 5, 5", report.Records, report.Head.Seq)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]Record) []Record
+	}{
+		{"modified record", func(c []Record) []Record {
+			c[2].Fields = []string{"record 3, edited"}
+			return c
+		}},
+		{"modified and rehashed record", func(c []Record) []Record {
+			// Rehashing the edited record still breaks the next link.
+			c[2].Fields = []string{"record 3, edited"}
+			c[2].Link = Next(&c[1].Link, c[2].Fields...)
+			return c
+		}},
+		{"deleted record", func(c []Record) []Record {
+			return append(c[:2], c[3:]...)
+		}},
+		{"deleted first record", func(c []Record) []Record {
+			return c[1:]
+		}},
+		{"reordered records", func(c []Record) []Record {
+			c[1], c[2] = c[2], c[1]
+			return c
+		}},
+		{"inserted record", func(c []Record) []Record {
+			forged := Record{ID: "x", Link: Next(&c[1].Link, "forged"), Fields: []string{"forged"}}
+			return append(c[:2], append([]Record{forged}, c[2:]...)...)
+		}},
+	}
+	for _, tt := range tests {
+		report := verify(tt.tamper(buildChain(5)))
+		if report.Valid {
+			t.Errorf("%s: chain reported valid", tt.name)
+		}
+	}
+}
+
+func TestVerifyDetectsTruncatedEnd(t *testing.T) {
+	chain := buildChain(5)
+	report := verify(chain[:3], checkpointAt(chain[4]))
+	if report.Valid {
+		t.Error("chain missing records after a checkpoint reported valid")
+	}
+}
+
+// Pruning removes a prefix and checkpoints the last removed record, as
+// PruneDownloads does; the remaining records must still verify.
+func TestVerifyPrunedChain(t *testing.T) {
+	chain := buildChain(6)
+	pruned := chain[3:]
+
+	report := verify(pruned, checkpointAt(chain[2]))
+	if !report.Valid {
+		t.Fatalf("chain pruned up to a checkpoint reported invalid: %+v", report.Problems)
+	}
+	if report.Records != 3 {
+		t.Errorf("records = %d, want 3", report.Records)
+	}
+
+	// Pruned again later, past an older checkpoint.
+	report = verify(chain[5:], checkpointAt(chain[2]), checkpointAt(chain[4]))
+	if !report.Valid {
+		t.Errorf("chain pruned twice reported invalid: %+v", report.Problems)
+	}
+}
+
+func TestVerifyPrunedChainNeedsCheckpoint(t *testing.T) {
+	chain := buildChain(6)
+	pruned := chain[3:]
+
+	if report := verify(pruned); report.Valid {
+		t.Error("prefix removed without a checkpoint reported valid")
+	}
+	if report := verify(pruned, checkpointAt(chain[1])); report.Valid {
+		t.Error("prefix removed past the checkpoint reported valid")
+	}
+	forged := checkpointAt(chain[2])
+	forged.Hash = Hash("forged")
+	if report := verify(pruned, forged); report.Valid {
+		t.Error("prefix vouched for by a checkpoint with another hash reported valid")
+	}
+
+	// A checkpoint only vouches for the records before it: deleting one
+	// after it is still caught.
+	tampered := append([]Record{}, pruned[:1]...)
+	tampered = append(tampered, pruned[2:]...)
+	if report := verify(tampered, checkpointAt(chain[2])); report.Valid {
+		t.Error("record deleted after the pruning checkpoint reported valid")
+	}
+}
@@ -0,0 +1,54 @@
+// Package listing holds the pagination and sorting rules shared by the
+// paginated list endpoints.
+package listing
+
+import (
+	"strings"
+
+	"github.com/samridh-111/balkan_task/internal/pkg/errors"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Page clamps a requested page and page size to valid values.
+func Page(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	return page, pageSize
+}
+
+// TotalPages returns how many pages of pageSize hold total items.
+func TotalPages(total, pageSize int) int {
+	return (total + pageSize - 1) / pageSize
+}
+
+// OrderBy builds an ORDER BY expression from a sort key, looked up in
+// columns, and an order of "asc" or "desc" (the default). The tiebreak
+// column keeps the order stable so pages do not overlap. Keys outside
+// columns are rejected, which keeps user input out of the SQL.
+func OrderBy(columns map[string]string, sort, order, defaultSort, tiebreak string) (string, error) {
+	if sort == "" {
+		sort = defaultSort
+	}
+	column, ok := columns[sort]
+	if !ok {
+		return "", errors.New(400, "invalid sort: "+sort)
+	}
+	switch strings.ToLower(order) {
+	case "", "desc":
+		return column + " DESC, " + tiebreak + " DESC", nil
+	case "asc":
+		return column + " ASC, " + tiebreak + " ASC", nil
+	}
+	return "", errors.New(400, "order must be asc or desc")
+}
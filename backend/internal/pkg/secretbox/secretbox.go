@@ -0,0 +1,59 @@
+// Package secretbox encrypts secrets that must be stored recoverably, such
+// as TOTP secrets and private signing keys, which cannot simply be hashed.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrMalformed = errors.New("secretbox: malformed ciphertext")
+
+// Box seals and opens secrets with AES-256-GCM.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New derives the AES key from key and purpose. Each kind of secret uses
+// its own purpose, so boxes built from the same key cannot open each
+// other's ciphertexts.
+func New(key, purpose string) *Box {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		panic("secretbox: " + err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic("secretbox: " + err.Error())
+	}
+	return &Box{aead: aead}
+}
+
+func (b *Box) Seal(plaintext string) string {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("secretbox: crypto/rand failed: " + err.Error())
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+func (b *Box) Open(ciphertext string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, sealed := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plaintext), nil
+}
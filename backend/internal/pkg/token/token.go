@@ -0,0 +1,26 @@
+// Package token generates opaque random tokens and the hashes stored in
+// place of them.
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// New returns a URL-safe random token carrying n bytes of entropy.
+func New(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("token: crypto/rand failed: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Hash returns the hex SHA-256 of a token. Tokens are stored hashed so a
+// database leak does not reveal usable credentials.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -12,8 +12,10 @@ function LoginPage() {
   const [password, setPassword] = useState("");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState("");
+  const [mfaToken, setMfaToken] = useState("");
+  const [mfaCode, setMfaCode] = useState("");
   const navigate = useNavigate();
-  const { login, register } = useAuth();
+  const { login, verifyMfa, register } = useAuth();
 
   const handleSubmit = async (e) => {
     e.preventDefault();
@@ -21,8 +23,18 @@ function LoginPage() {
     setError("");
 
     try {
-      if (isLogin) {
-        await login(email, password);
+      if (mfaToken) {
+        await verifyMfa(mfaToken, mfaCode);
+      } else if (isLogin) {
+        const result = await login(email, password);
+        if (result.mfa_enrollment_required) {
+          setError("Your account requires two-factor authentication. Ask an administrator for help enrolling.");
+          return;
+        }
+        if (result.mfa_required) {
+          setMfaToken(result.mfa_token);
+          return;
+        }
       } else {
         await register(email, password);
       }
@@ -49,6 +61,21 @@ function LoginPage() {
         </CardHeader>
         <CardContent>
           <form onSubmit={handleSubmit} className="space-y-4">
+            {mfaToken ? (
+              <div className="space-y-2">
+                <Label htmlFor="mfa-code">Authentication code</Label>
+                <Input
+                  id="mfa-code"
+                  inputMode="numeric"
+                  autoComplete="one-time-code"
+                  value={mfaCode}
+                  onChange={(e) => setMfaCode(e.target.value.trim())}
+                  required
+                  disabled={loading}
+                />
+              </div>
+            ) : (
+            <>
             <div className="space-y-2">
               <Label htmlFor="email">Email</Label>
               <Input
@@ -72,6 +99,8 @@ function LoginPage() {
                 disabled={loading}
               />
             </div>
+            </>
+            )}
             {error && (
               <div className="text-sm text-destructive bg-destructive/10 p-2 rounded">
                 {error}
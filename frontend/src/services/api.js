@@ -41,16 +41,53 @@ api.interceptors.request.use(
   }
 );
 
+// Access tokens are short-lived; exchange the refresh token for a new pair.
+// Concurrent 401s share a single refresh request because refresh tokens are
+// single-use.
+let refreshPromise = null;
+
+const refreshTokens = () => {
+  if (!refreshPromise) {
+    const refreshToken = localStorage.getItem('refresh_token');
+    refreshPromise = (refreshToken
+      ? axios.post(`${API_URL}/api/v1/auth/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error('No refresh token'))
+    )
+      .then(({ data }) => {
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refresh_token', data.refresh_token);
+        return data.token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
 // Response interceptor to handle errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
-    const { response } = error;
+  async (error) => {
+    const { response, config } = error;
+
+    // Retry once with a refreshed access token
+    if (response?.status === 401 && config && !config._retried && !config.url?.startsWith('/auth/')) {
+      config._retried = true;
+      try {
+        const token = await refreshTokens();
+        config.headers.Authorization = `Bearer ${token}`;
+        return api(config);
+      } catch {
+        // fall through to logout below
+      }
+    }
 
     // Handle authentication errors
     if (response?.status === 401) {
       // Clear auth data but don't redirect - let the router guards handle it
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       localStorage.removeItem('user');
       // Emit event to notify auth context
       authEvents.emit('logout');
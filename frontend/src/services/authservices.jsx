@@ -31,6 +31,7 @@ export const AuthProvider = ({ children }) => {
         console.error('Error initializing auth:', error);
         // Clear corrupted data
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('user');
       } finally {
         setLoading(false);
@@ -55,14 +56,25 @@ export const AuthProvider = ({ children }) => {
 
   }, []);
 
+  const storeSession = (data) => {
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+    localStorage.setItem('user', JSON.stringify(data.user));
+    setUser(data.user);
+  };
+
   const login = async (email, password) => {
     try {
       const response = await api.post('/auth/login', { email, password });
 
+      // Accounts with two-factor authentication get a challenge instead of
+      // tokens; the caller completes it with verifyMfa.
+      if (response.data.mfa_required) {
+        return response.data;
+      }
+
       if (response.data.token && response.data.user) {
-        localStorage.setItem('token', response.data.token);
-        localStorage.setItem('user', JSON.stringify(response.data.user));
-        setUser(response.data.user);
+        storeSession(response.data);
         return response.data;
       } else {
         throw new Error('Invalid response from server');
@@ -73,14 +85,18 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  const verifyMfa = async (mfaToken, code) => {
+    const response = await api.post('/auth/mfa/verify', { mfa_token: mfaToken, code });
+    storeSession(response.data);
+    return response.data;
+  };
+
   const register = async (email, password) => {
     try {
       const response = await api.post('/auth/register', { email, password });
 
       if (response.data.token && response.data.user) {
-        localStorage.setItem('token', response.data.token);
-        localStorage.setItem('user', JSON.stringify(response.data.user));
-        setUser(response.data.user);
+        storeSession(response.data);
         return response.data;
       } else {
         throw new Error('Invalid response from server');
@@ -91,8 +107,15 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
-  const logout = () => {
+  const logout = async () => {
+    try {
+      // Revoke the session server-side; local state is cleared regardless
+      await api.post('/auth/logout');
+    } catch (error) {
+      console.error('Logout error:', error);
+    }
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('user');
     setUser(null);
   };
@@ -111,6 +134,7 @@ export const AuthProvider = ({ children }) => {
     user,
     loading,
     login,
+    verifyMfa,
     register,
     logout,
     updateProfile,